@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/luishsr/eth-proxy/internal/handler"
 	"github.com/luishsr/eth-proxy/internal/nodemanager"
@@ -9,18 +12,21 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
 var (
-	// Define a Prometheus counter to track API calls per Ethereum node.
+	// Define a Prometheus counter to track API calls per endpoint and JSON-RPC method.
 	apiCallsPerNode = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "eth_proxy_api_calls_per_node_total",
-			Help: "Total number of API calls to the proxy per Ethereum node",
+			Help: "Total number of API calls to the proxy per endpoint and JSON-RPC method",
 		},
-		[]string{"node"},
+		[]string{"node", "method"},
 	)
 )
 
@@ -35,26 +41,76 @@ func NewServer(manager nodemanager.ClientManagerInterface) *Server {
 
 // handleEthBalance processes Ethereum balance requests via the /eth/balance/ endpoint.
 func (s *Server) handleEthBalance(w http.ResponseWriter, r *http.Request) {
-	// Extract Ethereum address from the request path.
-	address := strings.TrimPrefix(r.URL.Path, "/eth/balance/")
-
-	// Increment the counter for API calls
-	apiCallsPerNode.WithLabelValues("/eth/balance/").Inc()
-
-	// Validate Ethereum address format.
-	if !utils.IsValidEthereumAddress(address) {
-		utils.RespondError(w, http.StatusBadRequest, "Invalid Ethereum address")
+	// Per-node consensus reports are a diagnostic and require the admin token.
+	if strings.HasSuffix(r.URL.Path, "/consensus") {
+		handler.RequireAdmin(handler.NewAPIHandler(s.manager).ConsensusHandler())(w, r)
 		return
 	}
 
-	// Delegate the request to the handler's ProxyHandler function.
+	// Delegate the request to the handler's ProxyHandler function, which validates the address.
 	handlerFunc := handler.NewAPIHandler(s.manager).ProxyHandler()
 	handlerFunc.ServeHTTP(w, r)
 }
 
-// handleHealthz provides a simple health check endpoint.
-func (s *Server) handleHealthz(w http.ResponseWriter, _ *http.Request) {
-	w.WriteHeader(http.StatusOK)
+// handleHealthz provides a simple health check endpoint. With ?deep=true, which requires the
+// admin token since it fans out to every node, it probes them and reports their statuses.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("deep") != "true" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	handler.RequireAdmin(s.handleDeepHealthz)(w, r)
+}
+
+// handleDeepHealthz probes every node synchronously, failing when none are healthy.
+func (s *Server) handleDeepHealthz(w http.ResponseWriter, r *http.Request) {
+	statuses := s.manager.CheckAllNodes(r.Context())
+	statusCode := http.StatusServiceUnavailable
+	for _, status := range statuses {
+		if status.Healthy {
+			statusCode = http.StatusOK
+			break
+		}
+	}
+
+	utils.RespondJSON(w, statusCode, map[string]interface{}{"nodes": statuses})
+}
+
+// handleRecheck triggers an immediate health check of all nodes and returns their statuses.
+func (s *Server) handleRecheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{"nodes": s.manager.CheckAllNodes(r.Context())})
+}
+
+// handleNodes lists the configured nodes with their health and captured response headers. It is
+// mounted behind the admin token since it exposes provider hosts.
+func (s *Server) handleNodes(w http.ResponseWriter, _ *http.Request) {
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{"nodes": s.manager.ListNodes()})
+}
+
+// handleRemoveNode drains and removes the node named in DELETE /admin/nodes/{name}.
+func (s *Server) handleRemoveNode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		utils.RespondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/admin/nodes/")
+	if err := s.manager.RemoveNode(r.Context(), name); err != nil {
+		if errors.Is(err, nodemanager.ErrNodeNotFound) {
+			utils.RespondError(w, http.StatusNotFound, err.Error())
+		} else {
+			utils.RespondError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]string{"removed": name})
 }
 
 // handleReady checks if the service is ready to handle requests.
@@ -67,8 +123,15 @@ func (s *Server) handleReady(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
+// handleStats reports each node's share of recent selections against its expected share.
+func (s *Server) handleStats(w http.ResponseWriter, _ *http.Request) {
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{"selections": s.manager.SelectionStats()})
+}
+
 // LoadNodeConfigs loads node configuration from environment variables.
-func LoadNodeConfigs() []nodemanager.NodeConfig {
+// A node's health-check probe can be customised with <KEY>_HEALTHCHECK, e.g.
+// INFURA_ENDPOINT_HEALTHCHECK={"method":"eth_chainId","params":[]}.
+func LoadNodeConfigs() ([]nodemanager.NodeConfig, error) {
 	// Define a list of known node keys from the .env file.
 	nodeKeys := []string{
 		"ALCHEMY_ENDPOINT",
@@ -81,22 +144,175 @@ func LoadNodeConfigs() []nodemanager.NodeConfig {
 	var nodeConfigs []nodemanager.NodeConfig
 	for _, key := range nodeKeys {
 		if url := os.Getenv(key); url != "" {
+			if err := nodemanager.ValidateNodeURL(url); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+
 			// Use the key as the node's name and the environment variable's value as the URL.
-			nodeConfigs = append(nodeConfigs, nodemanager.NodeConfig{
+			nodeConfig := nodemanager.NodeConfig{
 				Name: key,
 				URL:  url,
-			})
+			}
+
+			// Validate any custom health-check template up front rather than on the first probe.
+			if raw := os.Getenv(key + "_HEALTHCHECK"); raw != "" {
+				healthCheck, err := nodemanager.ParseHealthCheckPayload(raw)
+				if err != nil {
+					return nil, fmt.Errorf("%s_HEALTHCHECK: %w", key, err)
+				}
+				nodeConfig.HealthCheck = healthCheck
+			}
+
+			// Some providers only accept JSON-RPC over GET; POST is the default.
+			if method := strings.ToUpper(os.Getenv(key + "_METHOD")); method != "" {
+				if method != http.MethodGet && method != http.MethodPost {
+					return nil, fmt.Errorf("%s_METHOD: unsupported HTTP method %q", key, method)
+				}
+				nodeConfig.Method = method
+			}
+
+			// Private nodes may need a custom CA, a client certificate or, as a last resort, no verification.
+			tlsOptions := nodemanager.NodeTLSOptions{
+				CAFile:             os.Getenv(key + "_TLS_CA_FILE"),
+				CertFile:           os.Getenv(key + "_TLS_CERT_FILE"),
+				KeyFile:            os.Getenv(key + "_TLS_KEY_FILE"),
+				InsecureSkipVerify: utils.GetEnvBool(key+"_TLS_INSECURE_SKIP_VERIFY", false),
+			}
+			if tlsOptions != (nodemanager.NodeTLSOptions{}) {
+				tlsConfig, err := nodemanager.NewNodeTLSConfig(tlsOptions)
+				if err != nil {
+					return nil, fmt.Errorf("%s TLS: %w", key, err)
+				}
+				nodeConfig.TLS = tlsConfig
+			}
+
+			// Clients sending a matching X-Client-Region prefer the node.
+			nodeConfig.Region = os.Getenv(key + "_REGION")
+
+			// Daily UTC windows, e.g. "02:00-03:00", during which the node is not selected.
+			maintenance, err := nodemanager.ParseMaintenanceWindows(os.Getenv(key + "_MAINTENANCE"))
+			if err != nil {
+				return nil, fmt.Errorf("%s_MAINTENANCE: %w", key, err)
+			}
+			nodeConfig.Maintenance = maintenance
+
+			// Client-side limit in requests per second, to stay under the provider's documented rate.
+			if raw := utils.GetEnv(key + "_RATE_LIMIT_RPS"); raw != "" {
+				rps, err := strconv.ParseFloat(raw, 64)
+				if err != nil || rps <= 0 {
+					return nil, fmt.Errorf("%s_RATE_LIMIT_RPS: expected a positive number, got %q", key, raw)
+				}
+				nodeConfig.RateLimit = rps
+			}
+
+			// Archive nodes serve queries at blocks ARCHIVE_MIN_DEPTH or more below the head; full nodes serve the rest.
+			nodeConfig.Archive = utils.GetEnvBool(key+"_ARCHIVE", false)
+
+			// Provider-specific block tag names, e.g. "finalized=safe".
+			aliases, err := nodemanager.ParseBlockTagAliases(os.Getenv(key + "_BLOCK_TAG_ALIASES"))
+			if err != nil {
+				return nil, fmt.Errorf("%s_BLOCK_TAG_ALIASES: %w", key, err)
+			}
+			nodeConfig.BlockTagAliases = aliases
+
+			nodeConfigs = append(nodeConfigs, nodeConfig)
 		}
 	}
 
-	return nodeConfigs
+	return nodeConfigs, nil
 }
 
-func main() {
-	// Register the API calls counter with Prometheus.
-	customRegistry := prometheus.NewRegistry()
-	customRegistry.MustRegister(apiCallsPerNode)
+// runSelfTest probes every node and fetches a balance from each, logging a summary and exiting
+// when no node passes.
+func runSelfTest(manager *nodemanager.ClientManager) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
+	passed := 0
+	for _, result := range manager.SelfTest(ctx) {
+		entry := utils.Logger.WithField("node", result.Node)
+		if result.Passed {
+			passed++
+			entry.WithField("balance", result.Balance).Info("Startup self-test passed")
+		} else {
+			entry.WithField("error", result.Error).Error("Startup self-test failed")
+		}
+	}
+
+	if passed == 0 {
+		utils.Logger.Fatal("Startup self-test failed on every node")
+	}
+	utils.Logger.WithField("passed", passed).Info("Startup self-test complete")
+}
+
+// newMetricsRegistry registers the proxy's metrics with a dedicated Prometheus registry. Should that
+// fail, the metrics are registered with the default registry instead, so /metrics keeps serving them.
+func newMetricsRegistry() prometheus.Gatherer {
+	collectors := []prometheus.Collector{apiCallsPerNode, handler.RequestDuration, handler.PanicsTotal, handler.InvalidAddressTotal, handler.APIKeyConcurrency, nodemanager.UpstreamDecodeErrors, nodemanager.DeadlineExceeded, nodemanager.UpstreamStale, nodemanager.NodesConfigured, nodemanager.NodesHealthy, nodemanager.CircuitBreakerState, nodemanager.NodeRateLimitRemaining, nodemanager.NodeThrottleWait, nodemanager.NodeLatency}
+
+	registry := prometheus.NewRegistry()
+	for _, collector := range collectors {
+		if err := registry.Register(collector); err != nil {
+			utils.Logger.WithError(err).Error("Failed to register metrics, falling back to the default registry")
+			return defaultMetricsRegistry(collectors)
+		}
+	}
+	return registry
+}
+
+// defaultMetricsRegistry registers collectors with the default Prometheus registry, skipping any already there.
+func defaultMetricsRegistry(collectors []prometheus.Collector) prometheus.Gatherer {
+	for _, collector := range collectors {
+		if err := prometheus.Register(collector); err != nil {
+			if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+				utils.Logger.WithError(err).Error("Failed to register metric with the default registry")
+			}
+		}
+	}
+	return prometheus.DefaultGatherer
+}
+
+// countCalls counts calls to the endpoint at path, which is served by the JSON-RPC method.
+func countCalls(path string, method string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiCallsPerNode.WithLabelValues(path, method).Inc()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routes lists the proxy's endpoints; /metrics and /metrics.json serve the given registry.
+func routes(manager nodemanager.ClientManagerInterface, registry prometheus.Gatherer) []handler.Route {
+	server := NewServer(manager)
+	return []handler.Route{
+		{Pattern: "/eth/balance/", Handler: countCalls("/eth/balance/", handler.MethodGetBalance, http.HandlerFunc(server.handleEthBalance))},
+		// Without an explicit route, ServeMux would redirect /eth/balance to /eth/balance/.
+		{Pattern: "/eth/balance", Handler: countCalls("/eth/balance/", handler.MethodGetBalance, http.HandlerFunc(server.handleEthBalance))},
+		{Pattern: "/eth/balances", Handler: countCalls("/eth/balances", handler.MethodGetBalance, handler.NewAPIHandler(manager).BalancesHandler())},
+		{Pattern: "/eth/estimate-gas", Handler: countCalls("/eth/estimate-gas", handler.MethodEstimateGas, handler.NewAPIHandler(manager).EstimateGasHandler())},
+		{Pattern: "/eth/gas-price", Handler: countCalls("/eth/gas-price", handler.MethodGasPrice, handler.NewAPIHandler(manager).GasPriceHandler())},
+		{Pattern: "/eth/nonce/", Handler: countCalls("/eth/nonce/", handler.MethodGetTransactionCount, handler.NewAPIHandler(manager).NonceHandler())},
+		{Pattern: "/eth/code/", Handler: countCalls("/eth/code/", handler.MethodGetCode, handler.NewAPIHandler(manager).CodeHandler())},
+		{Pattern: "/eth/storage/", Handler: countCalls("/eth/storage/", handler.MethodGetStorageAt, handler.NewAPIHandler(manager).StorageHandler())},
+		{Pattern: "/eth/token-balance/", Handler: countCalls("/eth/token-balance/", handler.MethodCall, handler.NewAPIHandler(manager).TokenBalanceHandler())},
+		{Pattern: "/eth/block-number", Handler: countCalls("/eth/block-number", handler.MethodBlockNumber, handler.NewAPIHandler(manager).BlockNumberHandler())},
+		{Pattern: "/eth/block/", Handler: countCalls("/eth/block/", handler.MethodGetBlockByNumber, handler.NewAPIHandler(manager).BlockHandler())},
+		{Pattern: "/healthz", Handler: http.HandlerFunc(server.handleHealthz)},
+		{Pattern: "/ready", Handler: http.HandlerFunc(server.handleReady)},
+		{Pattern: "/stats", Handler: http.HandlerFunc(server.handleStats)},
+		{Pattern: "/nodes", Handler: handler.RequireAdmin(server.handleNodes)},
+		{Pattern: "/admin/recheck", Handler: handler.RequireAdmin(server.handleRecheck)},
+		{Pattern: "/admin/nodes/", Handler: handler.RequireAdmin(server.handleRemoveNode)},
+		{Pattern: "/admin/verify/", Handler: handler.RequireAdmin(handler.NewAPIHandler(manager).VerifyHandler())},
+		{Pattern: "/admin/warm", Handler: handler.RequireAdmin(handler.NewAPIHandler(manager).WarmHandler())},
+		{Pattern: "/admin/cache/oldest", Handler: handler.RequireAdmin(handler.NewAPIHandler(manager).CacheOldestHandler())},
+		{Pattern: "/admin/cache/refresh-oldest", Handler: handler.RequireAdmin(handler.NewAPIHandler(manager).CacheRefreshOldestHandler())},
+		{Pattern: "/metrics", Handler: promhttp.HandlerFor(registry, promhttp.HandlerOpts{})},
+		{Pattern: "/metrics.json", Handler: handler.MetricsJSONHandler(registry, manager)},
+		{Pattern: "/openapi.json", Handler: handler.OpenAPIHandler()},
+	}
+}
+
+func main() {
 	// Load environment variables from a .env file in non-production environments.
 	if _, err := os.Stat(".env"); err == nil && os.Getenv("GO_ENV") != "production" {
 		if err := godotenv.Load(".env"); err != nil {
@@ -104,23 +320,70 @@ func main() {
 		}
 	}
 
+	utils.ValidateProfile()
+
 	// Initialize the ClientManager with appropriate configuration.
-	httpClient := &http.Client{Timeout: 10 * time.Second}
-	manager := nodemanager.NewClientManager(LoadNodeConfigs(), httpClient)
+	nodeConfigs, err := LoadNodeConfigs()
+	if err != nil {
+		utils.Logger.WithError(err).Fatal("Invalid Ethereum node configuration")
+	}
+
+	transport, err := nodemanager.NewUpstreamTransport()
+	if err != nil {
+		utils.Logger.WithError(err).Fatal("Invalid upstream transport configuration")
+	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	manager := nodemanager.NewClientManager(nodeConfigs, httpClient)
+
+	// Restore the cache persisted by the previous run, if enabled.
+	cachePath := os.Getenv("CACHE_PERSIST_PATH")
+	if cachePath != "" {
+		if err := manager.LoadCache(cachePath); err != nil {
+			utils.Logger.WithError(err).Warn("Failed to restore cache from disk, starting cold")
+		}
+	}
+
+	// Optionally verify every node works before serving, to catch misconfiguration at deploy time.
+	if utils.GetEnvBool("STARTUP_SELFTEST", false) {
+		runSelfTest(manager)
+	}
+
+	// Optionally open a connection to every node up front, sparing the first requests the handshake.
+	if utils.GetEnvBool("PREWARM_CONNECTIONS", false) {
+		manager.WarmConnections(time.Duration(utils.GetEnvInt("PREWARM_TIMEOUT_SECONDS", 5)) * time.Second)
+	}
 
 	// Start periodic health checks for Ethereum nodes.
 	manager.StartHealthChecks(30 * time.Second)
 
-	// Map routes
-	server := NewServer(manager)
-	http.Handle("/eth/balance/", http.HandlerFunc(server.handleEthBalance))
-	http.HandleFunc("/healthz", server.handleHealthz)
-	http.HandleFunc("/ready", server.handleReady)
-	http.Handle("/metrics", promhttp.Handler())
+	// Map routes; ENABLED_ENDPOINTS can switch individual endpoints off.
+	router := handler.NewRouter(routes(manager, newMetricsRegistry()))
 
 	// Start the HTTP server.
-	utils.Logger.Println("Starting Ethereum proxy server on :8088...")
-	if err := http.ListenAndServe(":8088", nil); err != nil {
-		utils.Logger.Fatal(err)
+	httpServer := &http.Server{Addr: ":8088", Handler: handler.RequestID(handler.Recover(handler.ClientRegion(handler.LimitConcurrencyPerKey(handler.Chaos(router)))))}
+	go func() {
+		utils.Logger.Println("Starting Ethereum proxy server on :8088...")
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			utils.Logger.Fatal(err)
+		}
+	}()
+
+	// Shut down gracefully on SIGINT/SIGTERM, persisting the cache once requests have drained.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	utils.Logger.Println("Shutting down Ethereum proxy server...")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		utils.Logger.WithError(err).Warn("Graceful shutdown did not complete")
+	}
+
+	if cachePath != "" {
+		if err := manager.SaveCache(cachePath); err != nil {
+			utils.Logger.WithError(err).Error("Failed to persist cache to disk")
+		}
 	}
 }
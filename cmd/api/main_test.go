@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/luishsr/eth-proxy/internal/handler"
+	"github.com/luishsr/eth-proxy/internal/nodemanager"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMetricsRouteServesCustomRegistry verifies /metrics exposes the proxy's own registry
+func TestMetricsRouteServesCustomRegistry(t *testing.T) {
+	manager := nodemanager.NewClientManager(nil, http.DefaultClient)
+	router := handler.NewRouter(routes(manager, newMetricsRegistry()))
+
+	apiCallsPerNode.WithLabelValues("/eth/balance/", handler.MethodGetBalance).Inc()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, `eth_proxy_api_calls_per_node_total{method="eth_getBalance",node="/eth/balance/"}`) {
+		t.Errorf("Expected the scrape to include the proxy's metrics, got:\n%s", body)
+	}
+	// The default registry's runtime collectors are not part of the custom registry.
+	if strings.Contains(body, "go_goroutines") {
+		t.Errorf("Expected the scrape to come from the custom registry, got the default one")
+	}
+}
+
+// TestMetricsRouteCountsRequests verifies a served request shows up in the /metrics scrape
+func TestMetricsRouteCountsRequests(t *testing.T) {
+	manager := nodemanager.NewClientManager(nil, http.DefaultClient)
+	router := handler.NewRouter(routes(manager, newMetricsRegistry()))
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/eth/code/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", nil))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if expected := `eth_proxy_api_calls_per_node_total{method="eth_getCode",node="/eth/code/"} 1`; !strings.Contains(rr.Body.String(), expected) {
+		t.Errorf("Expected the scrape to include %s, got:\n%s", expected, rr.Body.String())
+	}
+}
+
+// TestMetricsJSONReflectsRequests verifies /metrics.json counts served requests
+func TestMetricsJSONReflectsRequests(t *testing.T) {
+	manager := nodemanager.NewClientManager(nil, http.DefaultClient)
+	router := handler.NewRouter(routes(manager, newMetricsRegistry()))
+
+	scrape := func() handler.MetricsSummary {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics.json", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var summary handler.MetricsSummary
+		if err := json.Unmarshal(rr.Body.Bytes(), &summary); err != nil {
+			t.Fatalf("Failed to decode /metrics.json: %v", err)
+		}
+		return summary
+	}
+
+	before := scrape()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", nil))
+	after := scrape()
+
+	if got := after.Calls[handler.MethodGetBalance] - before.Calls[handler.MethodGetBalance]; got != 1 {
+		t.Errorf("Expected one more %s call, got %v", handler.MethodGetBalance, got)
+	}
+	if got := after.Cache.Misses - before.Cache.Misses; got != 1 {
+		t.Errorf("Expected one more cache miss, got %d", got)
+	}
+}
+
+// TestNodesRouteRequiresAdmin verifies /nodes is only served with the admin token
+func TestNodesRouteRequiresAdmin(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "Node1", URL: "http://example.com"}}, http.DefaultClient)
+	router := handler.NewRouter(routes(manager, newMetricsRegistry()))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/nodes", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without the token, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/nodes", nil)
+	req.Header.Set(handler.AdminTokenHeader, "secret")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d with the token, got %d", http.StatusOK, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `"name":"Node1"`) {
+		t.Errorf("Expected the node listing, got %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/luishsr/eth-proxy/internal/nodemanager"
+	"github.com/luishsr/eth-proxy/utils"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// AdminTokenHeader is the request header carrying the token required by admin endpoints.
+const AdminTokenHeader = "X-Admin-Token"
+
+// RequireAdmin restricts next to requests presenting the ADMIN_TOKEN configured in the environment.
+// Admin endpoints are disabled entirely when no token is configured.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if os.Getenv("ADMIN_TOKEN") == "" {
+			utils.RespondError(w, http.StatusForbidden, "Admin endpoints are disabled")
+			return
+		}
+
+		if !isAdmin(req) {
+			utils.RespondError(w, http.StatusUnauthorized, "Invalid admin token")
+			return
+		}
+
+		next(w, req)
+	}
+}
+
+// isAdmin reports whether req presents the configured ADMIN_TOKEN.
+func isAdmin(req *http.Request) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return false
+	}
+
+	provided := req.Header.Get(AdminTokenHeader)
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// warmRequest is the body accepted by WarmHandler.
+type warmRequest struct {
+	Addresses []string `json:"addresses"`
+}
+
+// WarmHandler returns an http.HandlerFunc that synchronously populates the cache for a list of
+// addresses posted as {"addresses":[...]}, reporting which lookups succeeded or failed.
+func (api *APIHandler) WarmHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			utils.RespondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		var body warmRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		// Repeated addresses are warmed and counted once.
+		addresses := make([]string, 0, len(body.Addresses))
+		seen := make(map[string]bool)
+		for _, address := range body.Addresses {
+			if !seen[address] {
+				seen[address] = true
+				addresses = append(addresses, address)
+			}
+		}
+
+		failures := make(map[string]string)
+		var valid []string
+		for _, address := range addresses {
+			if err := validateAddress(address); err != nil {
+				failures[address] = err.Error()
+				continue
+			}
+			valid = append(valid, address)
+		}
+
+		for _, result := range api.manager.GetBalances(req.Context(), valid) {
+			if result.Error != "" {
+				failures[result.Address] = result.Error
+			}
+		}
+
+		utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+			"succeeded": len(addresses) - len(failures),
+			"failed":    len(failures),
+			"errors":    failures,
+		})
+	}
+}
+
+// verifyReport is the outcome of auditing an address's balance across every healthy node.
+type verifyReport struct {
+	Address      string                    `json:"address"`
+	Majority     string                    `json:"majority,omitempty"`
+	Deviating    []string                  `json:"deviating"`
+	Cached       string                    `json:"cached,omitempty"`
+	CacheMatches *bool                     `json:"cacheMatches,omitempty"`
+	Nodes        []nodemanager.NodeBalance `json:"nodes"`
+}
+
+// VerifyHandler returns an http.HandlerFunc that audits /admin/verify/{address}: it fetches the
+// balance from every healthy node, bypassing the cache, and reports the nodes deviating from the
+// majority balance and whether the cached balance matches it. Without a majority, no node is
+// flagged and majority is omitted.
+func (api *APIHandler) VerifyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			utils.RespondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		address := strings.TrimPrefix(req.URL.Path, "/admin/verify/")
+		if err := validateAddress(address); err != nil {
+			respondInvalidAddress(w, err)
+			return
+		}
+
+		balances := api.manager.GetBalanceAllNodes(req.Context(), address)
+		report := verifyReport{Address: address, Deviating: []string{}, Nodes: balances}
+		majority, found := nodemanager.MajorityBalance(balances)
+		if found {
+			report.Majority = majority
+			for _, b := range balances {
+				if b.Error == "" && b.Balance != majority {
+					report.Deviating = append(report.Deviating, b.Node)
+				}
+			}
+		}
+		if cached, ok := api.manager.CachedBalance(address); ok {
+			matches := found && cached == majority
+			report.Cached = cached
+			report.CacheMatches = &matches
+		}
+
+		utils.RespondJSON(w, http.StatusOK, report)
+	}
+}
+
+// cacheEntryCount parses the ?n= count of cache entries, 10 by default.
+func cacheEntryCount(req *http.Request) (int, error) {
+	raw := req.URL.Query().Get("n")
+	if raw == "" {
+		return 10, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("n must be a positive integer")
+	}
+	return n, nil
+}
+
+// CacheOldestHandler returns an http.HandlerFunc that lists the ?n= (10 by default) least recently
+// fetched cached balances with their ages.
+func (api *APIHandler) CacheOldestHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			utils.RespondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		n, err := cacheEntryCount(req)
+		if err != nil {
+			utils.RespondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		utils.RespondJSON(w, http.StatusOK, map[string]interface{}{"entries": api.manager.OldestCacheEntries(n)})
+	}
+}
+
+// CacheRefreshOldestHandler returns an http.HandlerFunc that re-fetches the ?n= (10 by default)
+// least recently fetched cached balances and reports each outcome.
+func (api *APIHandler) CacheRefreshOldestHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			utils.RespondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		n, err := cacheEntryCount(req)
+		if err != nil {
+			utils.RespondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		utils.RespondJSON(w, http.StatusOK, map[string]interface{}{"refreshed": api.manager.RefreshOldestCacheEntries(req.Context(), n)})
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/luishsr/eth-proxy/internal/nodemanager"
+	"github.com/luishsr/eth-proxy/utils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ndjsonContentType is the media type of a streamed batch response, one JSON object per line.
+const ndjsonContentType = "application/x-ndjson"
+
+// balanceEntry is one address's outcome in a batch balance response.
+type balanceEntry struct {
+	Balance string `json:"balance,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BalancesHandler returns an http.HandlerFunc that looks up the balances of a JSON array of
+// addresses posted to /eth/balances, responding with a map of address to balance. Lookups run
+// concurrently, bounded by BATCH_CONCURRENCY; an invalid address or failed lookup sets that
+// entry's error instead of failing the batch. At most BATCH_MAX_ADDRESSES (100 by default)
+// addresses are accepted. With Accept: application/x-ndjson the results are instead streamed as
+// one {"address","balance"|"error"} line per address, each flushed as soon as its lookup
+// completes; lookups still pending when the client disconnects are cancelled.
+func (api *APIHandler) BalancesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			utils.RespondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		var addresses []string
+		if err := json.NewDecoder(req.Body).Decode(&addresses); err != nil {
+			utils.RespondErrorCode(w, http.StatusBadRequest, "INVALID_BODY", "invalid request body: expected a JSON array of addresses")
+			return
+		}
+		if limit := utils.GetEnvInt("BATCH_MAX_ADDRESSES", 100); len(addresses) > limit {
+			utils.RespondErrorCode(w, http.StatusRequestEntityTooLarge, "BATCH_TOO_LARGE", fmt.Sprintf("at most %d addresses are accepted per batch", limit))
+			return
+		}
+
+		response := make(map[string]balanceEntry, len(addresses))
+		var valid []string
+		for _, address := range addresses {
+			if _, seen := response[address]; seen {
+				continue
+			}
+			if err := validateAddress(address); err != nil {
+				response[address] = balanceEntry{Error: err.Error()}
+				continue
+			}
+			response[address] = balanceEntry{}
+			valid = append(valid, address)
+		}
+
+		if strings.Contains(req.Header.Get("Accept"), ndjsonContentType) {
+			api.streamBalances(w, req, addresses, response, valid)
+			return
+		}
+
+		start := time.Now()
+		for _, result := range api.manager.GetBalances(req.Context(), valid) {
+			response[result.Address] = balanceEntry{Balance: result.Balance, Error: result.Error}
+		}
+		observeRequest(MethodGetBalance, cacheNone, start)
+
+		utils.RespondJSON(w, http.StatusOK, response)
+	}
+}
+
+// streamBalances writes the NDJSON form of a batch response: the entries already known to be
+// invalid first, then each valid address's result as its lookup completes.
+func (api *APIHandler) streamBalances(w http.ResponseWriter, req *http.Request, addresses []string, response map[string]balanceEntry, valid []string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.RespondError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	written := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		if entry := response[address]; entry.Error != "" && !written[address] {
+			written[address] = true
+			if err := encoder.Encode(nodemanager.AddressBalance{Address: address, Error: entry.Error}); err != nil {
+				return
+			}
+		}
+	}
+	flusher.Flush()
+
+	start := time.Now()
+	defer observeRequest(MethodGetBalance, cacheNone, start)
+	results := api.manager.StreamBalances(ctx, valid)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case result, ok := <-results:
+			if !ok {
+				return
+			}
+			if err := encoder.Encode(result); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
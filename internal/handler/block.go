@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"errors"
+	"github.com/luishsr/eth-proxy/internal/nodemanager"
+	"github.com/luishsr/eth-proxy/utils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BlockHandler returns an http.HandlerFunc that fetches the block at /eth/block/{number}, a block
+// tag or a hex or decimal block number, and responds with the node's block JSON. With ?full=true
+// transactions are included as objects rather than hashes. Unknown blocks are a 404.
+func (api *APIHandler) BlockHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		number := strings.TrimPrefix(req.URL.Path, "/eth/block/")
+		full := req.URL.Query().Get("full") == "true"
+
+		start := time.Now()
+		block, err := api.manager.GetBlockByNumber(req.Context(), number, full)
+		observeRequest(MethodGetBlockByNumber, cacheNone, start)
+		if err != nil {
+			if errors.Is(err, nodemanager.ErrNullResult) {
+				utils.RespondErrorCode(w, http.StatusNotFound, "BLOCK_NOT_FOUND", "block not found")
+			} else {
+				respondLookupError(w, req, err)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(block)
+	}
+}
+
+// BlockNumberHandler returns an http.HandlerFunc that responds with the chain head at
+// /eth/block-number as {"blockNumber":"0x..."}, or as a base-10 string with ?format=decimal.
+func (api *APIHandler) BlockNumberHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		format := req.URL.Query().Get("format")
+		if format != "" && format != "hex" && format != "decimal" {
+			utils.RespondErrorCode(w, http.StatusBadRequest, "INVALID_FORMAT", "invalid format: expected hex or decimal")
+			return
+		}
+
+		start := time.Now()
+		number, err := api.manager.BlockNumber(req.Context())
+		observeRequest(MethodBlockNumber, cacheNone, start)
+		if err != nil {
+			respondLookupError(w, req, err)
+			return
+		}
+
+		if format == "decimal" {
+			if number, err = utils.HexToDecimalString(number); err != nil {
+				utils.RespondError(w, http.StatusInternalServerError, "Invalid block number returned by node")
+				return
+			}
+		}
+		utils.RespondJSON(w, http.StatusOK, map[string]string{"blockNumber": number})
+	}
+}
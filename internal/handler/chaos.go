@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"github.com/luishsr/eth-proxy/utils"
+	"github.com/sirupsen/logrus"
+	"math/rand"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Chaos injects latency and failures into responses so clients' retry and timeout handling can be
+// exercised against the real proxy. It only takes effect with CHAOS_ENABLED=true, and never when
+// GO_ENV=production: each request is then delayed by CHAOS_DELAY_MS and fails with a 503 with a
+// probability of CHAOS_ERROR_RATE percent. Settings are read once, when the middleware is created.
+func Chaos(next http.Handler) http.Handler {
+	if !utils.GetEnvBool("CHAOS_ENABLED", false) {
+		return next
+	}
+	if os.Getenv("GO_ENV") == "production" {
+		utils.Logger.Error("Ignoring CHAOS_ENABLED in production")
+		return next
+	}
+
+	delay := time.Duration(utils.GetEnvInt("CHAOS_DELAY_MS", 0)) * time.Millisecond
+	errorRate := utils.GetEnvInt("CHAOS_ERROR_RATE", 0)
+	utils.Logger.WithFields(logrus.Fields{
+		"delay":      delay,
+		"error_rate": errorRate,
+	}).Warn("Chaos mode enabled: responses will be delayed and fail at random")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-req.Context().Done():
+				return
+			}
+		}
+
+		if errorRate > 0 && rand.Intn(100) < errorRate {
+			utils.RespondError(w, http.StatusServiceUnavailable, "Injected failure (chaos mode)")
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
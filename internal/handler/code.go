@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"github.com/luishsr/eth-proxy/utils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CodeHandler returns an http.HandlerFunc that fetches the bytecode at /eth/code/{address}?block=latest
+// and responds with {"code":"0x..."}, where "0x" means an externally owned account.
+func (api *APIHandler) CodeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		address := strings.TrimPrefix(req.URL.Path, "/eth/code/")
+		if err := validateAddress(address); err != nil {
+			respondInvalidAddress(w, err)
+			return
+		}
+
+		block := req.URL.Query().Get("block")
+		if block == "" {
+			block = "latest"
+		}
+
+		start := time.Now()
+		code, err := api.manager.GetCode(req.Context(), address, block)
+		observeRequest(MethodGetCode, cacheNone, start)
+		if err != nil {
+			respondLookupError(w, req, err)
+			return
+		}
+
+		utils.RespondJSON(w, http.StatusOK, map[string]string{"code": code})
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/luishsr/eth-proxy/utils"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAPIKeyHeader is the header carrying the client's API key when API_KEY_HEADER is unset.
+// It matches the key name used by the Kong key-auth plugin in deployments/.
+const DefaultAPIKeyHeader = "apikey"
+
+// APIKeyHeader returns the header name the client's API key is read from.
+func APIKeyHeader() string {
+	if header := os.Getenv("API_KEY_HEADER"); header != "" {
+		return header
+	}
+	return DefaultAPIKeyHeader
+}
+
+// keyBucket is a concurrency allowance shared by the requests mapped to it.
+type keyBucket struct {
+	semaphore chan struct{}
+	label     string // APIKeyConcurrency label; a key fingerprint, or "default".
+}
+
+// LimitConcurrencyPerKey caps how many requests each API key may have in flight, rejecting the
+// excess with a 429 asking to retry after CONCURRENCY_RETRY_AFTER_MS (1000 by default). Keys
+// listed in API_KEY_CONCURRENCY ("key1=10,key2=2") get their own limit; all other keys share a single API_KEY_DEFAULT_CONCURRENCY allowance, so unknown keys cannot
+// grow memory or metric cardinality. Requests without a key, and other keys when no default is
+// set, are not limited. Limits are read once, when the middleware is created.
+func LimitConcurrencyPerKey(next http.Handler) http.Handler {
+	buckets := make(map[string]*keyBucket)
+	for key, limit := range parseKeyLimits(utils.GetEnv("API_KEY_CONCURRENCY")) {
+		buckets[key] = &keyBucket{semaphore: make(chan struct{}, limit), label: keyFingerprint(key)}
+	}
+
+	var defaultBucket *keyBucket
+	if limit := utils.GetEnvInt("API_KEY_DEFAULT_CONCURRENCY", 0); limit > 0 {
+		defaultBucket = &keyBucket{semaphore: make(chan struct{}, limit), label: "default"}
+	}
+
+	retryAfter := time.Duration(utils.GetEnvInt("CONCURRENCY_RETRY_AFTER_MS", 1000)) * time.Millisecond
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(APIKeyHeader())
+		bucket, ok := buckets[key]
+		if !ok {
+			bucket = defaultBucket
+		}
+		if key == "" || bucket == nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		select {
+		case bucket.semaphore <- struct{}{}:
+		default:
+			utils.RespondShed(w, http.StatusTooManyRequests, "TOO_MANY_CONCURRENT_REQUESTS", "Too many concurrent requests for this API key", retryAfter)
+			return
+		}
+
+		gauge := APIKeyConcurrency.WithLabelValues(bucket.label)
+		gauge.Inc()
+		defer func() {
+			gauge.Dec()
+			<-bucket.semaphore
+		}()
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// parseKeyLimits parses "key=limit" pairs, ignoring malformed entries.
+func parseKeyLimits(raw string) map[string]int {
+	limits := make(map[string]int)
+	for _, entry := range strings.Split(raw, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found {
+			continue
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || limit <= 0 {
+			utils.Logger.WithField("key", keyFingerprint(key)).Warn("Ignoring invalid API_KEY_CONCURRENCY entry")
+			continue
+		}
+		limits[strings.TrimSpace(key)] = limit
+	}
+	return limits
+}
+
+// keyFingerprint identifies an API key in logs and metrics without revealing it.
+func keyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/luishsr/eth-proxy/internal/nodemanager"
+	"github.com/luishsr/eth-proxy/utils"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// EstimateGasHandler returns an http.HandlerFunc that estimates the gas for a transaction call
+// object posted to /eth/estimate-gas. With ?buffer=N the estimate is raised by N percent (rounded
+// up) as headroom for state-dependent transactions; without it the node's estimate is returned as is.
+func (api *APIHandler) EstimateGasHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			utils.RespondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		buffer := 0
+		if raw := req.URL.Query().Get("buffer"); raw != "" {
+			var err error
+			if buffer, err = strconv.Atoi(raw); err != nil || buffer < 0 {
+				utils.RespondError(w, http.StatusBadRequest, "Invalid buffer: must be a non-negative integer percentage")
+				return
+			}
+		}
+
+		var tx map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&tx); err != nil || tx == nil {
+			utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		start := time.Now()
+		gas, err := api.manager.EstimateGas(req.Context(), tx)
+		observeRequest(MethodEstimateGas, cacheNone, start)
+		if err != nil {
+			// The node rejecting the transaction (e.g. it reverts) is the caller's problem, not ours.
+			var rpcErr *nodemanager.RPCError
+			if errors.As(err, &rpcErr) {
+				status, ok := rpcErrorStatus(rpcErr.Code)
+				if !ok {
+					status = http.StatusBadRequest
+				}
+				utils.RespondError(w, status, err.Error())
+			} else {
+				utils.Logger.Println("Error estimating gas:", err)
+				utils.RespondError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		utils.RespondJSON(w, http.StatusOK, map[string]string{"gas": fmt.Sprintf("0x%x", applyGasBuffer(gas, buffer))})
+	}
+}
+
+// applyGasBuffer returns gas increased by percent, rounded up.
+func applyGasBuffer(gas *big.Int, percent int) *big.Int {
+	buffered := new(big.Int).Mul(gas, big.NewInt(int64(100+percent)))
+	buffered.Add(buffered, big.NewInt(99))
+	return buffered.Quo(buffered, big.NewInt(100))
+}
+
+// GasPriceHandler returns an http.HandlerFunc that responds with the current gas price at
+// /eth/gas-price as {"gasPrice":"0x..."} in wei, or with ?unit=wei|gwei|ether as an exact decimal
+// string in that unit.
+func (api *APIHandler) GasPriceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		unit := req.URL.Query().Get("unit")
+		if unit != "" {
+			if _, err := utils.WeiToUnit("0x0", unit); err != nil {
+				utils.RespondErrorCode(w, http.StatusBadRequest, "INVALID_UNIT", err.Error())
+				return
+			}
+		}
+
+		start := time.Now()
+		price, err := api.manager.GasPrice(req.Context())
+		observeRequest(MethodGasPrice, cacheNone, start)
+		if err != nil {
+			respondLookupError(w, req, err)
+			return
+		}
+
+		if unit != "" {
+			if price, err = utils.WeiToUnit(price, unit); err != nil {
+				utils.RespondError(w, http.StatusInternalServerError, "Invalid gas price returned by node")
+				return
+			}
+		}
+		utils.RespondJSON(w, http.StatusOK, map[string]string{"gasPrice": price})
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// JSON-RPC methods behind each endpoint, used as the method metric label. Only these values are
+// recorded, which keeps the label's cardinality bounded.
+const (
+	MethodGetBalance          = "eth_getBalance"
+	MethodGetCode             = "eth_getCode"
+	MethodGetStorageAt        = "eth_getStorageAt"
+	MethodEstimateGas         = "eth_estimateGas"
+	MethodGetBlockByNumber    = "eth_getBlockByNumber"
+	MethodCall                = "eth_call"
+	MethodBlockNumber         = "eth_blockNumber"
+	MethodGasPrice            = "eth_gasPrice"
+	MethodGetTransactionCount = "eth_getTransactionCount"
+)
+
+// cacheNone labels requests to endpoints that do not report whether they were served from cache.
+const cacheNone = "none"
+
+var (
+	// RequestDuration tracks request latency per JSON-RPC method, split by whether the result was served from cache.
+	RequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "eth_proxy_request_duration_seconds",
+			Help:    "Latency of requests, labeled by JSON-RPC method and cache hit or miss",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method", "cache"},
+	)
+
+	// PanicsTotal counts handler panics caught by the Recover middleware.
+	PanicsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "eth_proxy_panics_total",
+			Help: "Number of panics recovered in HTTP handlers",
+		},
+	)
+
+	// InvalidAddressTotal counts requests rejected for a missing, malformed or mis-checksummed
+	// address, a sign of a buggy client integration.
+	InvalidAddressTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "eth_proxy_invalid_address_total",
+			Help: "Number of requests rejected for an invalid address, labeled by reason",
+		},
+		[]string{"reason"},
+	)
+
+	// APIKeyConcurrency tracks in-flight requests per API key, labeled by a fingerprint of the key.
+	APIKeyConcurrency = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "eth_proxy_api_key_concurrent_requests",
+			Help: "Number of in-flight requests per API key fingerprint",
+		},
+		[]string{"key"},
+	)
+)
+
+// observeRequest records the latency of a request for method that started at start.
+func observeRequest(method string, cache string, start time.Time) {
+	RequestDuration.WithLabelValues(method, cache).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"github.com/luishsr/eth-proxy/internal/nodemanager"
+	"github.com/luishsr/eth-proxy/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"net/http"
+)
+
+// MetricsSummary is a plain JSON digest of the Prometheus metrics, for deployments without Prometheus.
+type MetricsSummary struct {
+	Calls map[string]float64 `json:"calls"` // API calls per JSON-RPC method.
+	Cache CacheSummary       `json:"cache"`
+	Nodes []NodeHealth       `json:"nodes"`
+}
+
+// CacheSummary counts requests served from cache and from the nodes.
+type CacheSummary struct {
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hitRate"` // Hits over hits and misses; 0 before any request.
+}
+
+// NodeHealth is a node's current health.
+type NodeHealth struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+}
+
+// MetricsJSONHandler serves a MetricsSummary at /metrics.json. It is derived from gatherer, which
+// /metrics serves too, so both report the same numbers.
+func MetricsJSONHandler(gatherer prometheus.Gatherer, manager nodemanager.ClientManagerInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		families, err := gatherer.Gather()
+		if err != nil {
+			utils.RespondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		summary := MetricsSummary{Calls: map[string]float64{}, Nodes: []NodeHealth{}}
+		for _, family := range families {
+			switch family.GetName() {
+			case "eth_proxy_api_calls_per_node_total":
+				for _, metric := range family.GetMetric() {
+					summary.Calls[labelValue(metric, "method")] += metric.GetCounter().GetValue()
+				}
+			case "eth_proxy_request_duration_seconds":
+				for _, metric := range family.GetMetric() {
+					switch labelValue(metric, "cache") {
+					case "hit":
+						summary.Cache.Hits += metric.GetHistogram().GetSampleCount()
+					case "miss":
+						summary.Cache.Misses += metric.GetHistogram().GetSampleCount()
+					}
+				}
+			}
+		}
+		if total := summary.Cache.Hits + summary.Cache.Misses; total > 0 {
+			summary.Cache.HitRate = float64(summary.Cache.Hits) / float64(total)
+		}
+
+		for _, node := range manager.ListNodes() {
+			summary.Nodes = append(summary.Nodes, NodeHealth{Name: node.Name, Healthy: node.Healthy && !node.Draining})
+		}
+
+		utils.RespondJSON(w, http.StatusOK, summary)
+	}
+}
+
+// labelValue returns the value of metric's label name, or "" if it has none.
+func labelValue(metric *dto.Metric, name string) string {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"github.com/luishsr/eth-proxy/internal/nodemanager"
+	"github.com/luishsr/eth-proxy/utils"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"runtime/debug"
+)
+
+// RequestID tags each request with a correlation ID, taken from the configured request-ID
+// header when the client supplies one and generated otherwise. The ID is echoed back in the
+// response and carried in the request context so it can be forwarded to upstream nodes.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header := utils.RequestIDHeader()
+
+		id := req.Header.Get(header)
+		if id == "" {
+			id = utils.NewRequestID()
+		}
+
+		w.Header().Set(header, id)
+		next.ServeHTTP(w, req.WithContext(utils.WithRequestID(req.Context(), id)))
+	})
+}
+
+// ClientRegionHeader lets clients name their region so nearby nodes are preferred.
+const ClientRegionHeader = "X-Client-Region"
+
+// ClientRegion carries the client's X-Client-Region in the request context, so upstream calls
+// prefer same-region nodes.
+func ClientRegion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if region := req.Header.Get(ClientRegionHeader); region != "" {
+			req = req.WithContext(nodemanager.WithClientRegion(req.Context(), region))
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Recover catches panics raised by next, logs them with a stack trace and responds with a
+// 500 in the standard error envelope instead of dropping the connection.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered) // Deliberate aborts are left to net/http.
+			}
+
+			PanicsTotal.Inc()
+			utils.Logger.WithFields(logrus.Fields{
+				"panic":      recovered,
+				"method":     req.Method,
+				"path":       req.URL.Path,
+				"request_id": utils.RequestIDFromContext(req.Context()),
+				"stack":      string(debug.Stack()),
+			}).Error("Recovered from panic in HTTP handler")
+
+			utils.RespondError(w, http.StatusInternalServerError, "Internal server error")
+		}()
+
+		next.ServeHTTP(w, req)
+	})
+}
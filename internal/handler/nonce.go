@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"github.com/luishsr/eth-proxy/utils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NonceHandler returns an http.HandlerFunc that fetches the transaction count of
+// /eth/nonce/{address}?block=latest and responds with {"nonce":"0x..."}, or with the nonce as a
+// base-10 string with ?format=decimal.
+func (api *APIHandler) NonceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		address := strings.TrimPrefix(req.URL.Path, "/eth/nonce/")
+		if err := validateAddress(address); err != nil {
+			respondInvalidAddress(w, err)
+			return
+		}
+
+		format := req.URL.Query().Get("format")
+		if format != "" && format != "hex" && format != "decimal" {
+			utils.RespondErrorCode(w, http.StatusBadRequest, "INVALID_FORMAT", "invalid format: expected hex or decimal")
+			return
+		}
+
+		block := req.URL.Query().Get("block")
+		if block == "" {
+			block = "latest"
+		}
+
+		start := time.Now()
+		nonce, err := api.manager.GetTransactionCount(req.Context(), address, block)
+		observeRequest(MethodGetTransactionCount, cacheNone, start)
+		if err != nil {
+			respondLookupError(w, req, err)
+			return
+		}
+
+		if format == "decimal" {
+			if nonce, err = utils.HexToDecimalString(nonce); err != nil {
+				utils.RespondError(w, http.StatusInternalServerError, "Invalid nonce returned by node")
+				return
+			}
+		}
+		utils.RespondJSON(w, http.StatusOK, map[string]string{"nonce": nonce})
+	}
+}
@@ -1,13 +1,50 @@
 package handler
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/luishsr/eth-proxy/internal/nodemanager" // Import for accessing the ClientManagerInterface
 	"github.com/luishsr/eth-proxy/utils"                // Import for utility functions like logging and responding with JSON
+	"math/big"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// addressErrorCodes maps address validation failures to the codes returned in the error envelope.
+var addressErrorCodes = map[error]string{
+	utils.ErrMissingAddress:   "MISSING_ADDRESS",
+	utils.ErrMalformedAddress: "MALFORMED_ADDRESS",
+	utils.ErrInvalidChecksum:  "INVALID_CHECKSUM",
+}
+
+// BlockNumberHeader reports the block a pinned (?pin=true) or ?timestamp= read was made at.
+const BlockNumberHeader = "X-Block-Number"
+
+// NodeHeader names the upstream node a balance was read from; for a cached balance, the node that
+// served it when it was cached.
+const NodeHeader = "X-Eth-Node"
+
+// RequireFreshHeader lets clients refuse cached balances while no upstream node is available.
+const RequireFreshHeader = "X-Require-Fresh"
+
+// TimingHeader breaks a balance request's latency down by phase when DEBUG_TIMING=true, e.g.
+// "validation=0.021ms, cache=0.004ms, select=0.009ms, upstream=1.532ms".
+const TimingHeader = "X-Timing"
+
+// TimeoutHeader lets clients override the upstream request timeout, in milliseconds.
+const TimeoutHeader = "X-Timeout-Ms"
+
+// maxSafeInteger is the largest integer every JSON number parser represents exactly (2^53-1).
+var maxSafeInteger = big.NewInt(1<<53 - 1)
+
+// weiPerEther is the number of wei in one ether.
+var weiPerEther = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
 // APIHandler holds a reference to the ClientManagerInterface to interact with Ethereum nodes.
 type APIHandler struct {
 	manager nodemanager.ClientManagerInterface
@@ -21,30 +58,373 @@ func NewAPIHandler(manager nodemanager.ClientManagerInterface) *APIHandler {
 // ProxyHandler returns an http.HandlerFunc that handles Ethereum balance requests.
 func (api *APIHandler) ProxyHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
-		// Extract the Ethereum address from the URL path, removing the prefix.
-		address := strings.TrimPrefix(req.URL.Path, "/eth/balance/")
+		received := time.Now()
 
-		// Validate the Ethereum address format.
-		if address == "" || !utils.IsValidEthereumAddress(address) {
-			// Respond with an error if the address is invalid or missing.
-			utils.RespondError(w, http.StatusBadRequest, "Invalid or missing Ethereum address")
+		// Extract the Ethereum address from the URL path, tolerating a trailing slash.
+		address, err := balancePathAddress(req, "/")
+		if err == nil {
+			// Validate the Ethereum address, telling missing, malformed and bad-checksum addresses apart.
+			err = validateAddress(address)
+		}
+		if err != nil {
+			respondInvalidAddress(w, err)
 			return
 		}
 
-		// Attempt to retrieve the balance for the given Ethereum address.
-		balance, err := api.manager.GetBalance(address)
+		// Apply the client's own latency budget, if it sent one.
+		ctx := req.Context()
+		if header := req.Header.Get(TimeoutHeader); header != "" {
+			timeout, err := parseRequestTimeout(header)
+			if err != nil {
+				utils.RespondErrorCode(w, http.StatusBadRequest, "INVALID_TIMEOUT", err.Error())
+				return
+			}
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(nodemanager.WithNodeTimeout(ctx, timeout), timeout)
+			defer cancel()
+		}
+
+		format := req.URL.Query().Get("format")
+		formats, ok := parseFormats(format)
+		if !ok {
+			utils.RespondErrorCode(w, http.StatusBadRequest, "INVALID_FORMAT", "invalid format: expected a comma-separated list of hex, decimal, number or eth")
+			return
+		}
+		unit := req.URL.Query().Get("unit")
+		if unit != "" {
+			if _, err := utils.WeiToUnit("0x0", unit); err != nil {
+				utils.RespondErrorCode(w, http.StatusBadRequest, "INVALID_UNIT", err.Error())
+				return
+			}
+			if format != "" {
+				utils.RespondErrorCode(w, http.StatusBadRequest, "INVALID_UNIT", "unit cannot be combined with format")
+				return
+			}
+		}
+
+		// With DEBUG_TIMING=true, report where the request's latency went in the X-Timing header.
+		var timing *nodemanager.Timing
+		if utils.GetEnvBool("DEBUG_TIMING", false) {
+			ctx, timing = nodemanager.WithTiming(ctx)
+			timing.Add(nodemanager.PhaseValidation, time.Since(received))
+		}
+
+		// Attempt to retrieve the balance for the given Ethereum address, timing cache hits and misses apart.
+		start := time.Now()
+		block := req.URL.Query().Get("block")
+		if block == "" {
+			block = "latest"
+		}
+		// With ?pin=true, read at the current block number and report it, so follow-up reads can pass
+		// it back as ?block= for a consistent snapshot.
+		pinned := block == "latest" && req.URL.Query().Get("pin") == "true"
+		if pinned {
+			if block, err = api.manager.BlockNumber(ctx); err != nil {
+				respondLookupError(w, req, err)
+				return
+			}
+		}
+		// With ?timestamp= (Unix seconds), read at the last block mined by then and report it likewise.
+		if raw := req.URL.Query().Get("timestamp"); raw != "" {
+			timestamp, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || req.URL.Query().Get("block") != "" {
+				utils.RespondErrorCode(w, http.StatusBadRequest, "INVALID_TIMESTAMP", "invalid timestamp: expected Unix seconds and no block parameter")
+				return
+			}
+			if block, err = api.manager.BlockAtTimestamp(ctx, timestamp); err != nil {
+				respondLookupError(w, req, err)
+				return
+			}
+			pinned = true
+		}
+		if pinned {
+			w.Header().Set(BlockNumberHeader, block)
+		}
+		result, err := api.manager.GetBalanceAt(ctx, address, block)
+		if timing != nil {
+			w.Header().Set(TimingHeader, timing.String())
+		}
+		cacheLabel := "miss"
+		if err == nil && result.Cached {
+			cacheLabel = "hit"
+		}
+		observeRequest(MethodGetBalance, cacheLabel, start)
+
 		if err != nil {
-			// Check if the error is due to an invalid address and respond accordingly.
-			if errors.Is(err, utils.ErrInvalidAddress) {
-				utils.RespondError(w, http.StatusBadRequest, err.Error())
+			respondLookupError(w, req, err)
+			return
+		}
+
+		// In strict mode, never answer from the cache alone: with every node down, fail instead.
+		if result.Cached && requireFresh(req) && !api.manager.IsReady() {
+			utils.RespondErrorCode(w, http.StatusServiceUnavailable, "UPSTREAM_UNAVAILABLE", "no healthy nodes to confirm the cached balance")
+			return
+		}
+
+		// X-Cache tells cached balances apart from fresh ones, flagging expired balances served
+		// because the refresh failed.
+		if result.Node != "" {
+			w.Header().Set(NodeHeader, result.Node)
+		}
+		switch {
+		case result.Stale:
+			w.Header().Set("X-Cache", "STALE")
+		case result.Cached:
+			w.Header().Set("X-Cache", "HIT")
+		default:
+			w.Header().Set("X-Cache", "MISS")
+		}
+
+		// With ?raw=true, relay the upstream JSON-RPC envelope verbatim.
+		if req.URL.Query().Get("raw") == "true" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(result.Raw)
+			return
+		}
+
+		// With ?quote=usd, respond with the balance in ether and its approximate USD value.
+		if req.URL.Query().Get("quote") == "usd" {
+			api.respondWithQuote(w, req, result.Balance)
+			return
+		}
+
+		// Respond with the retrieved balance in JSON format, under BALANCE_RESPONSE_KEY if set.
+		key := balanceResponseKey()
+		response := map[string]interface{}{key: result.Balance}
+		// With ?unit=wei|gwei|ether, return the balance in that unit as an exact decimal string.
+		if unit != "" {
+			converted, err := utils.WeiToUnit(result.Balance, unit)
+			if err != nil {
+				utils.RespondError(w, http.StatusInternalServerError, "Invalid balance returned by node")
+				return
+			}
+			response[key] = converted
+		}
+		// With ?format=, return the balance in the requested representation; with several
+		// (?format=hex,decimal,eth), return each of them, computed from the same balance.
+		for _, f := range formats {
+			value, unsafe, err := formatBalance(result.Balance, f)
+			if err != nil {
+				utils.RespondError(w, http.StatusInternalServerError, "Invalid balance returned by node")
+				return
+			}
+			if len(formats) == 1 {
+				response[key] = value
 			} else {
-				utils.Logger.Println("Error fetching balance:", err)
-				utils.RespondError(w, http.StatusInternalServerError, err.Error())
+				delete(response, key)
+				response[f] = value
 			}
+			if unsafe {
+				response["numberUnsafe"] = true
+			}
+		}
+		if pinned {
+			response["block"] = block
+		}
+		utils.RespondJSON(w, http.StatusOK, response)
+	}
+}
+
+// parseFormats splits a ?format= list, reporting false for unknown or repeated formats.
+func parseFormats(raw string) ([]string, bool) {
+	if raw == "" {
+		return nil, true
+	}
+	formats := strings.Split(raw, ",")
+	seen := make(map[string]bool, len(formats))
+	for i, f := range formats {
+		f = strings.TrimSpace(f)
+		if seen[f] || (f != "hex" && f != "decimal" && f != "number" && f != "eth") {
+			return nil, false
+		}
+		seen[f] = true
+		formats[i] = f
+	}
+	return formats, true
+}
+
+// formatBalance renders a hex wei balance as format: hex as is, decimal as a base-10 wei string,
+// eth as an exact decimal ether string, and number as a JSON number when that is exact. Balances
+// too large for an exact number are returned as decimal strings, with unsafe set.
+func formatBalance(balance string, format string) (value interface{}, unsafe bool, err error) {
+	switch format {
+	case "decimal":
+		value, err = utils.HexToDecimalString(balance)
+	case "eth":
+		value, err = utils.WeiToUnit(balance, "ether")
+	case "number":
+		wei, ok := new(big.Int).SetString(strings.TrimPrefix(balance, "0x"), 16)
+		if !ok {
+			return nil, false, fmt.Errorf("invalid balance %q", balance)
+		}
+		if wei.Cmp(maxSafeInteger) <= 0 {
+			return wei.Uint64(), false, nil
+		}
+		return wei.String(), true, nil
+	default:
+		value = balance
+	}
+	return value, false, err
+}
+
+// balanceResponseKey returns the JSON field balances are returned under: BALANCE_RESPONSE_KEY,
+// for clients expecting e.g. "result" or "wei", or "balance" by default.
+func balanceResponseKey() string {
+	if key := os.Getenv("BALANCE_RESPONSE_KEY"); key != "" {
+		return key
+	}
+	return "balance"
+}
+
+// requireFresh reports whether the request, or REQUIRE_FRESH globally, asks for strict freshness.
+func requireFresh(req *http.Request) bool {
+	return req.Header.Get(RequireFreshHeader) == "true" || utils.GetEnvBool("REQUIRE_FRESH", false)
+}
+
+// respondLookupError maps a failed lookup to its response: 400 for invalid input, 504 when the
+// deadline passed, 503 while the circuit breaker is open or no archive node can serve a historical
+// query, the mapped status for JSON-RPC errors (see rpcErrorStatus) and 500 for other upstream
+// failures.
+func respondLookupError(w http.ResponseWriter, req *http.Request, err error) {
+	if errors.Is(err, utils.ErrInvalidAddress) {
+		utils.RespondError(w, http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, nodemanager.ErrInvalidBlock) {
+		utils.RespondErrorCode(w, http.StatusBadRequest, "INVALID_BLOCK", err.Error())
+	} else if errors.Is(err, nodemanager.ErrInvalidTimestamp) {
+		utils.RespondErrorCode(w, http.StatusBadRequest, "INVALID_TIMESTAMP", err.Error())
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		utils.RespondError(w, http.StatusGatewayTimeout, err.Error())
+	} else if errors.Is(err, nodemanager.ErrNoArchiveNode) {
+		utils.RespondErrorCode(w, http.StatusServiceUnavailable, "NO_ARCHIVE_NODE", err.Error())
+	} else if errors.Is(err, nodemanager.ErrCircuitOpen) {
+		retryAfter := time.Second
+		var circuitErr *nodemanager.CircuitOpenError
+		if errors.As(err, &circuitErr) {
+			retryAfter = circuitErr.RetryAfter
+		}
+		utils.RespondShed(w, http.StatusServiceUnavailable, "CIRCUIT_OPEN", err.Error(), retryAfter)
+	} else if status, ok := rpcStatus(err); ok {
+		utils.RespondError(w, status, err.Error())
+	} else {
+		utils.Logger.WithError(err).WithField("path", req.URL.Path).Error("Upstream lookup failed")
+		respondUpstreamError(w, req, err)
+	}
+}
+
+// respondUpstreamError responds with a 500 for a failed upstream lookup. Admins passing ?debug=true
+// also get every failed attempt, to tell apart nodes failing for different reasons.
+func respondUpstreamError(w http.ResponseWriter, req *http.Request, err error) {
+	var exhausted *nodemanager.RetriesExhaustedError
+	if req.URL.Query().Get("debug") == "true" && isAdmin(req) && errors.As(err, &exhausted) {
+		utils.RespondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error":    err.Error(),
+			"attempts": exhausted.Attempts,
+		})
+		return
+	}
+
+	utils.RespondError(w, http.StatusInternalServerError, err.Error())
+}
+
+// parseRequestTimeout parses an X-Timeout-Ms value, clamping it to MAX_REQUEST_TIMEOUT_MS (30s by default).
+func parseRequestTimeout(header string) (time.Duration, error) {
+	ms, err := strconv.Atoi(header)
+	if err != nil || ms <= 0 {
+		return 0, fmt.Errorf("invalid %s header: must be a positive integer", TimeoutHeader)
+	}
+	if maxMs := utils.GetEnvInt("MAX_REQUEST_TIMEOUT_MS", 30000); ms > maxMs {
+		ms = maxMs
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// balancePathAddress extracts the percent-decoded address segment from /eth/balance[/{address}[suffix]].
+// Both /eth/balance and /eth/balance/ yield an empty address. An undecodable segment is malformed.
+// Whitespace around the address, typically pasted in from a spreadsheet, is dropped unless
+// TRIM_ADDRESS_WHITESPACE=false.
+func balancePathAddress(req *http.Request, suffix string) (string, error) {
+	segment := strings.TrimPrefix(req.URL.EscapedPath(), "/eth/balance")
+	segment = strings.TrimPrefix(segment, "/")
+	segment = strings.TrimSuffix(segment, suffix)
+
+	address, err := url.PathUnescape(segment)
+	if err != nil {
+		return "", utils.ErrMalformedAddress
+	}
+	if utils.GetEnvBool("TRIM_ADDRESS_WHITESPACE", true) {
+		address = strings.TrimSpace(address)
+	}
+	return address, nil
+}
+
+// validateAddress validates a client-supplied address like utils.ValidateEthereumAddress. With
+// STRICT_CHECKSUM=true, addresses must also carry a valid EIP-55 checksum.
+func validateAddress(address string) error {
+	if err := utils.ValidateEthereumAddress(address); err != nil {
+		return err
+	}
+	if utils.GetEnvBool("STRICT_CHECKSUM", false) && !utils.IsValidChecksumAddress(address) {
+		return utils.ErrInvalidChecksum
+	}
+	return nil
+}
+
+// respondInvalidAddress rejects a request whose address failed validation, counting the rejection.
+func respondInvalidAddress(w http.ResponseWriter, err error) {
+	code := addressErrorCodes[err]
+	InvalidAddressTotal.WithLabelValues(code).Inc()
+	utils.RespondErrorCode(w, http.StatusBadRequest, code, err.Error())
+}
+
+// respondWithQuote writes the balance in ether along with its USD value. A failing price oracle
+// only drops the quote; the balance is still returned.
+func (api *APIHandler) respondWithQuote(w http.ResponseWriter, req *http.Request, balance string) {
+	wei, ok := new(big.Int).SetString(strings.TrimPrefix(balance, "0x"), 16)
+	if !ok {
+		utils.RespondError(w, http.StatusInternalServerError, "Invalid balance returned by node")
+		return
+	}
+	ether := new(big.Rat).SetFrac(wei, weiPerEther)
+	response := map[string]string{"eth": formatRat(ether, 18)}
+
+	price, err := api.manager.GetEthUsdPrice(req.Context())
+	if err != nil {
+		utils.Logger.WithError(err).Warn("ETH/USD price unavailable, returning balance without quote")
+	} else {
+		response["usd"] = new(big.Rat).Mul(ether, price).FloatString(2)
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// formatRat renders r with at most precision decimals, dropping trailing zeros.
+func formatRat(r *big.Rat, precision int) string {
+	formatted := r.FloatString(precision)
+	if strings.Contains(formatted, ".") {
+		formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	}
+	return formatted
+}
+
+// ConsensusHandler returns an http.HandlerFunc that queries every healthy node for an address's
+// balance at /eth/balance/{address}/consensus and reports whether they agree.
+func (api *APIHandler) ConsensusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		address, err := balancePathAddress(req, "/consensus")
+		if err == nil {
+			err = validateAddress(address)
+		}
+		if err != nil {
+			respondInvalidAddress(w, err)
 			return
 		}
 
-		// Respond with the retrieved balance in JSON format.
-		utils.RespondJSON(w, http.StatusOK, map[string]string{"balance": balance})
+		balances := api.manager.GetBalanceAllNodes(req.Context(), address)
+		utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+			"address": address,
+			"agree":   nodemanager.BalancesAgree(balances),
+			"nodes":   balances,
+		})
 	}
 }
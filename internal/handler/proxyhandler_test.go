@@ -1,13 +1,22 @@
 package handler
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/luishsr/eth-proxy/internal/nodemanager"
 	"github.com/luishsr/eth-proxy/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -15,10 +24,14 @@ import (
 // MockClientManager is a mock implementation of the ClientManager
 type MockClientManager struct {
 	Balance    string
+	Cached     bool
+	Stale      bool
 	Err        error
 	Cache      map[string]nodemanager.CacheItem
 	httpClient *http.Client
 	Nodes      []nodemanager.EthereumNode
+	Stream     chan nodemanager.AddressBalance // Results for StreamBalances; GetBalances's if nil.
+	StreamCtx  chan context.Context            // Receives the context StreamBalances is called with.
 }
 
 // Provide dummy implementations for GetNodeName and IsReady to prevent panics
@@ -30,6 +43,113 @@ func (m *MockClientManager) IsReady() bool {
 	return true
 }
 
+func (m *MockClientManager) CheckAllNodes(_ context.Context) []nodemanager.NodeStatus {
+	statuses := make([]nodemanager.NodeStatus, 0, len(m.Nodes))
+	for _, node := range m.Nodes {
+		statuses = append(statuses, nodemanager.NodeStatus{Name: node.Name, Healthy: node.Healthy})
+	}
+	return statuses
+}
+
+func (m *MockClientManager) GetBalanceAllNodes(_ context.Context, _ string) []nodemanager.NodeBalance {
+	balances := make([]nodemanager.NodeBalance, 0, len(m.Nodes))
+	for _, node := range m.Nodes {
+		balances = append(balances, nodemanager.NodeBalance{Node: node.Name, Balance: m.Balance})
+	}
+	return balances
+}
+
+func (m *MockClientManager) CachedBalance(_ string) (string, bool) {
+	return m.Balance, m.Cached
+}
+
+func (m *MockClientManager) GetBalances(_ context.Context, addresses []string) []nodemanager.AddressBalance {
+	results := make([]nodemanager.AddressBalance, 0, len(addresses))
+	for _, address := range addresses {
+		results = append(results, nodemanager.AddressBalance{Address: address, Balance: m.Balance})
+	}
+	return results
+}
+
+func (m *MockClientManager) StreamBalances(ctx context.Context, addresses []string) <-chan nodemanager.AddressBalance {
+	if m.StreamCtx != nil {
+		m.StreamCtx <- ctx
+	}
+	if m.Stream != nil {
+		return m.Stream
+	}
+	results := make(chan nodemanager.AddressBalance, len(addresses))
+	for _, result := range m.GetBalances(ctx, addresses) {
+		results <- result
+	}
+	close(results)
+	return results
+}
+
+func (m *MockClientManager) SelectionStats() []nodemanager.NodeSelectionShare {
+	return nil
+}
+
+func (m *MockClientManager) GetEthUsdPrice(_ context.Context) (*big.Rat, error) {
+	return nil, nodemanager.ErrPriceFeedNotConfigured
+}
+
+func (m *MockClientManager) RemoveNode(_ context.Context, _ string) error {
+	return nodemanager.ErrNodeNotFound
+}
+
+func (m *MockClientManager) EstimateGas(_ context.Context, _ map[string]interface{}) (*big.Int, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	gas, _ := new(big.Int).SetString(strings.TrimPrefix(m.Balance, "0x"), 16)
+	return gas, nil
+}
+
+func (m *MockClientManager) ListNodes() []nodemanager.NodeInfo {
+	return nil
+}
+
+func (m *MockClientManager) BlockNumber(_ context.Context) (string, error) {
+	return "0x10", m.Err
+}
+
+func (m *MockClientManager) BlockAtTimestamp(_ context.Context, _ int64) (string, error) {
+	return "0x8", m.Err
+}
+
+func (m *MockClientManager) GetCode(_ context.Context, _ string, _ string) (string, error) {
+	return m.Balance, m.Err
+}
+
+func (m *MockClientManager) GetStorageAt(_ context.Context, _ string, _ string, _ string) (string, error) {
+	return m.Balance, m.Err
+}
+
+func (m *MockClientManager) GasPrice(_ context.Context) (string, error) {
+	return m.Balance, m.Err
+}
+
+func (m *MockClientManager) GetTransactionCount(_ context.Context, _ string, _ string) (string, error) {
+	return m.Balance, m.Err
+}
+
+func (m *MockClientManager) GetTokenBalance(_ context.Context, _ string, _ string, _ string) (string, error) {
+	return m.Balance, m.Err
+}
+
+func (m *MockClientManager) GetBlockByNumber(_ context.Context, number string, _ bool) (json.RawMessage, error) {
+	return json.RawMessage(fmt.Sprintf(`{"number":"%s"}`, number)), m.Err
+}
+
+func (m *MockClientManager) OldestCacheEntries(_ int) []nodemanager.CacheEntryAge {
+	return nil
+}
+
+func (m *MockClientManager) RefreshOldestCacheEntries(_ context.Context, _ int) []nodemanager.CacheRefresh {
+	return nil
+}
+
 func (m *MockClientManager) GetBalance(address string) (string, error) {
 	if !utils.IsValidEthereumAddress(address) {
 		return "", utils.ErrInvalidAddress
@@ -37,6 +157,23 @@ func (m *MockClientManager) GetBalance(address string) (string, error) {
 	return m.Balance, m.Err
 }
 
+func (m *MockClientManager) GetBalanceAtBlock(address string, _ string) (string, error) {
+	return m.GetBalance(address)
+}
+
+func (m *MockClientManager) GetBalanceResult(_ context.Context, address string) (*nodemanager.BalanceResult, error) {
+	balance, err := m.GetBalance(address)
+	if err != nil {
+		return nil, err
+	}
+	raw := []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"result":"%s"}`, balance))
+	return &nodemanager.BalanceResult{Balance: balance, Raw: raw, Cached: m.Cached, Stale: m.Stale, Node: "MockNode"}, nil
+}
+
+func (m *MockClientManager) GetBalanceAt(ctx context.Context, address string, _ string) (*nodemanager.BalanceResult, error) {
+	return m.GetBalanceResult(ctx, address)
+}
+
 // setEnv is a helper function for setting an environment variable for the duration of a test.
 func setEnv(t *testing.T, key, value string) {
 	t.Helper() // Marks this function as a test helper function.
@@ -142,13 +279,45 @@ func TestProxyHandler(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			expectedBody:   `{"balance":"100"}`,
 		},
+		{
+			name:           "Missing address",
+			address:        "",
+			mockBalance:    "",
+			mockError:      nil,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"missing address","code":"MISSING_ADDRESS"}`,
+		},
 		{
 			name:           "Invalid address",
 			address:        "0xInvalid",
 			mockBalance:    "",
 			mockError:      nil,
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   `{"error":"Invalid or missing Ethereum address"}`,
+			expectedBody:   `{"error":"malformed address","code":"MALFORMED_ADDRESS"}`,
+		},
+		{
+			name:           "Non-hex address",
+			address:        "0xZZa3Ac5E156B4B291ceB59D019121beB6508d93D",
+			mockBalance:    "",
+			mockError:      nil,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"malformed address","code":"MALFORMED_ADDRESS"}`,
+		},
+		{
+			name:           "Bad checksum",
+			address:        "0x00A3Ac5E156B4B291ceB59D019121beB6508d93D",
+			mockBalance:    "",
+			mockError:      nil,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"invalid checksum","code":"INVALID_CHECKSUM"}`,
+		},
+		{
+			name:           "Lowercase address without checksum",
+			address:        "0x00a3ac5e156b4b291ceb59d019121beb6508d93d",
+			mockBalance:    "100",
+			mockError:      nil,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"balance":"100"}`,
 		},
 		{
 			name:           "Error fetching balance",
@@ -201,6 +370,461 @@ func TestProxyHandler(t *testing.T) {
 	}
 }
 
+// TestProxyHandlerRaw verifies ?raw=true relays the upstream JSON-RPC envelope
+func TestProxyHandlerRaw(t *testing.T) {
+	handler := NewAPIHandler(&MockClientManager{Balance: "0x10"})
+
+	req := httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?raw=true", nil)
+	rr := httptest.NewRecorder()
+	handler.ProxyHandler().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if expected := `{"jsonrpc":"2.0","id":1,"result":"0x10"}`; rr.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+// addressRecorder is a MockClientManager that records the address balances are requested for
+type addressRecorder struct {
+	*MockClientManager
+	address string
+}
+
+func (m *addressRecorder) GetBalanceAt(ctx context.Context, address string, block string) (*nodemanager.BalanceResult, error) {
+	m.address = address
+	return m.MockClientManager.GetBalanceAt(ctx, address, block)
+}
+
+// TestProxyHandlerTrimsAddressWhitespace verifies a whitespace-padded address is accepted and trimmed
+func TestProxyHandlerTrimsAddressWhitespace(t *testing.T) {
+	manager := &addressRecorder{MockClientManager: &MockClientManager{Balance: "0x1"}}
+	handler := NewAPIHandler(manager)
+
+	rr := httptest.NewRecorder()
+	handler.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/%20%090x00a3Ac5E156B4B291ceB59D019121beB6508d93D%20", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if expected := "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"; manager.address != expected {
+		t.Errorf("Expected the trimmed address %q to be looked up, got %q", expected, manager.address)
+	}
+
+	// Whitespace inside the address is not trimmed.
+	rr = httptest.NewRecorder()
+	handler.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB%2059D019121beB6508d93D", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for inner whitespace, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestBlockHandlerFullFlag verifies the full flag and a decimal block number are forwarded to eth_getBlockByNumber
+func TestBlockHandlerFullFlag(t *testing.T) {
+	params := make(chan []interface{}, 2)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rpcReq struct {
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&rpcReq)
+		if rpcReq.Method == "eth_blockNumber" {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x100"}`))
+			return
+		}
+		params <- rpcReq.Params
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"number":"0x10","transactions":[]}}`))
+	}))
+	defer mockServer.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	handler := NewAPIHandler(manager).BlockHandler()
+
+	for _, full := range []bool{true, false} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/eth/block/16?full=%t", full), nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if expected := `{"number":"0x10","transactions":[]}`; rr.Body.String() != expected {
+			t.Errorf("Expected body %s, got %s", expected, rr.Body.String())
+		}
+		got := <-params
+		if len(got) != 2 || got[0] != "0x10" || got[1] != full {
+			t.Errorf("Expected params [0x10 %t], got %v", full, got)
+		}
+	}
+}
+
+// TestBlockHandlerNotFound verifies a null block is a 404
+func TestBlockHandlerNotFound(t *testing.T) {
+	mockServer := mockEthereumNode(`{"jsonrpc":"2.0","id":1,"result":null}`, http.StatusOK)
+	defer mockServer.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	rr := httptest.NewRecorder()
+	NewAPIHandler(manager).BlockHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/block/0xffffff", nil))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusNotFound, rr.Code, rr.Body.String())
+	}
+}
+
+// TestBlockNumberHandler verifies the chain head is returned as hex or, on request, decimal
+func TestBlockNumberHandler(t *testing.T) {
+	handler := NewAPIHandler(&MockClientManager{}).BlockNumberHandler()
+
+	for query, expected := range map[string]string{"": `{"blockNumber":"0x10"}`, "?format=decimal": `{"blockNumber":"16"}`} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/block-number"+query, nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != expected {
+			t.Errorf("Expected %s for %q, got %d %s", expected, query, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/block-number?format=octal", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid format, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestProxyHandlerBalanceResponseKey verifies the balance is returned under BALANCE_RESPONSE_KEY
+func TestProxyHandlerBalanceResponseKey(t *testing.T) {
+	setEnv(t, "BALANCE_RESPONSE_KEY", "wei")
+	defer unsetEnv(t, "BALANCE_RESPONSE_KEY")
+
+	rr := httptest.NewRecorder()
+	NewAPIHandler(&MockClientManager{Balance: "0x7"}).ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", nil))
+
+	if expected := `{"wei":"0x7"}`; strings.TrimSpace(rr.Body.String()) != expected {
+		t.Errorf("Expected body %s, got %s", expected, rr.Body.String())
+	}
+}
+
+// TestProxyHandlerCircuitOpen verifies an open circuit breaker sheds load with the backpressure body and header
+func TestProxyHandlerCircuitOpen(t *testing.T) {
+	handler := NewAPIHandler(&MockClientManager{Err: &nodemanager.CircuitOpenError{RetryAfter: 2500 * time.Millisecond}})
+
+	rr := httptest.NewRecorder()
+	handler.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	assertShed(t, rr, "CIRCUIT_OPEN", 2500, "3")
+}
+
+// assertShed checks a load-shedding response carries code, retryAfterMs and the Retry-After header
+func assertShed(t *testing.T, rr *httptest.ResponseRecorder, code string, retryAfterMs int64, retryAfter string) {
+	t.Helper()
+	var body struct {
+		Error struct {
+			Code         string `json:"code"`
+			Message      string `json:"message"`
+			RetryAfterMs int64  `json:"retryAfterMs"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode shed response %s: %v", rr.Body.String(), err)
+	}
+	if body.Error.Code != code || body.Error.Message == "" || body.Error.RetryAfterMs != retryAfterMs {
+		t.Errorf("Expected code %s with a message and retryAfterMs %d, got %s", code, retryAfterMs, rr.Body.String())
+	}
+	if got := rr.Header().Get("Retry-After"); got != retryAfter {
+		t.Errorf("Expected Retry-After %s, got %q", retryAfter, got)
+	}
+}
+
+// TestProxyHandlerTimestamp verifies ?timestamp= reads at the resolved block and rejects invalid timestamps
+func TestProxyHandlerTimestamp(t *testing.T) {
+	handler := NewAPIHandler(&MockClientManager{Balance: "0x7"}).ProxyHandler()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?timestamp=1700000000", nil))
+	if expected := `{"balance":"0x7","block":"0x8"}`; rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != expected {
+		t.Errorf("Expected %s, got %d %s", expected, rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get(BlockNumberHeader); got != "0x8" {
+		t.Errorf("Expected %s 0x8, got %q", BlockNumberHeader, got)
+	}
+
+	for _, query := range []string{"timestamp=yesterday", "timestamp=1700000000&block=0x1"} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?"+query, nil))
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "INVALID_TIMESTAMP") {
+			t.Errorf("Expected 400 INVALID_TIMESTAMP for %s, got %d %s", query, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	NewAPIHandler(&MockClientManager{Err: nodemanager.ErrInvalidTimestamp}).ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?timestamp=1", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a timestamp before genesis, got %d", rr.Code)
+	}
+}
+
+// TestProxyHandlerStrictChecksum verifies STRICT_CHECKSUM rejects addresses without a valid EIP-55 checksum
+func TestProxyHandlerStrictChecksum(t *testing.T) {
+	handler := NewAPIHandler(&MockClientManager{Balance: "0x1"}).ProxyHandler()
+	checksummed := "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+	lowercase := strings.ToLower(checksummed)
+
+	status := func(address string) int {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/"+address, nil))
+		return rr.Code
+	}
+
+	if code := status(lowercase); code != http.StatusOK {
+		t.Errorf("Expected a lowercase address to be accepted by default, got %d", code)
+	}
+
+	setEnv(t, "STRICT_CHECKSUM", "true")
+	defer unsetEnv(t, "STRICT_CHECKSUM")
+
+	if code := status(checksummed); code != http.StatusOK {
+		t.Errorf("Expected a checksummed address to be accepted in strict mode, got %d", code)
+	}
+	if code := status(lowercase); code != http.StatusBadRequest {
+		t.Errorf("Expected a lowercase address to be rejected in strict mode, got %d", code)
+	}
+	if code := status("0x00A3aC5E156B4B291ceB59D019121beB6508d93D"); code != http.StatusBadRequest {
+		t.Errorf("Expected a wrong-case address to be rejected in strict mode, got %d", code)
+	}
+}
+
+// TestProxyHandlerDecimalFormat verifies ?format=decimal returns the balance as a base-10 wei string
+func TestProxyHandlerDecimalFormat(t *testing.T) {
+	rr := httptest.NewRecorder()
+	NewAPIHandler(&MockClientManager{Balance: "0x1bc16d674ec80000"}).ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?format=decimal", nil))
+
+	if expected := `{"balance":"2000000000000000000"}`; rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != expected {
+		t.Errorf("Expected %s, got %d %s", expected, rr.Code, rr.Body.String())
+	}
+}
+
+// TestProxyHandlerMultipleFormats verifies ?format= lists return every representation of one balance
+func TestProxyHandlerMultipleFormats(t *testing.T) {
+	handler := NewAPIHandler(&MockClientManager{Balance: "0x1bc16d674ec80000"}).ProxyHandler()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?format=hex,decimal,eth", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var response map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := map[string]string{"hex": "0x1bc16d674ec80000", "decimal": "2000000000000000000", "eth": "2"}
+	if !reflect.DeepEqual(response, expected) {
+		t.Errorf("Expected %v, got %v", expected, response)
+	}
+
+	for _, format := range []string{"hex,wei", "hex,hex"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?format="+format, nil))
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "INVALID_FORMAT") {
+			t.Errorf("Expected 400 INVALID_FORMAT for %q, got %d %s", format, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// TestProxyHandlerUnit verifies ?unit= converts the balance and rejects unknown units
+func TestProxyHandlerUnit(t *testing.T) {
+	handler := NewAPIHandler(&MockClientManager{Balance: "0x1bc16d674ec80000"}).ProxyHandler()
+
+	for query, expected := range map[string]string{
+		"unit=ether": `{"balance":"2"}`,
+		"unit=gwei":  `{"balance":"2000000000"}`,
+		"unit=wei":   `{"balance":"2000000000000000000"}`,
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?"+query, nil))
+		if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != expected {
+			t.Errorf("Expected %s for %s, got %d %s", expected, query, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?unit=finney", nil))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "INVALID_UNIT") {
+		t.Errorf("Expected 400 INVALID_UNIT for an unknown unit, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+// TestProxyHandlerNumberFormat verifies ?format=number returns small balances as numbers and huge ones as flagged strings
+func TestProxyHandlerNumberFormat(t *testing.T) {
+	for balance, expected := range map[string]string{
+		"0x3039":             `{"balance":12345}`,
+		"0x1fffffffffffff":   `{"balance":9007199254740991}`,
+		"0x20000000000000":   `{"balance":"9007199254740992","numberUnsafe":true}`,
+		"0x1bc16d674ec80000": `{"balance":"2000000000000000000","numberUnsafe":true}`,
+	} {
+		rr := httptest.NewRecorder()
+		NewAPIHandler(&MockClientManager{Balance: balance}).ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?format=number", nil))
+		if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != expected {
+			t.Errorf("Expected %s for %s, got %d %s", expected, balance, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	NewAPIHandler(&MockClientManager{Balance: "0x1"}).ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?format=float", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown format, got %d", rr.Code)
+	}
+}
+
+// TestRPCErrorStatusMapping verifies JSON-RPC error codes map to their default or configured HTTP statuses
+func TestRPCErrorStatusMapping(t *testing.T) {
+	setEnv(t, "RPC_STATUS_CODES", "3=400,-32000=409,-32001=bogus")
+	defer unsetEnv(t, "RPC_STATUS_CODES")
+
+	tests := []struct {
+		name     string
+		code     int
+		expected int
+	}{
+		{"Default rate limit", -32005, http.StatusTooManyRequests},
+		{"Default invalid params", -32602, http.StatusBadRequest},
+		{"Configured revert", 3, http.StatusBadRequest},
+		{"Configured server error", -32000, http.StatusConflict},
+		{"Invalid override falls back", -32001, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAPIHandler(&MockClientManager{Err: &nodemanager.RPCError{Code: tt.code, Message: "rejected"}})
+			rr := httptest.NewRecorder()
+			handler.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", nil))
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d for JSON-RPC code %d, got %d", tt.expected, tt.code, rr.Code)
+			}
+		})
+	}
+
+	// Estimates keep treating unmapped node rejections as the caller's fault.
+	rr := httptest.NewRecorder()
+	NewAPIHandler(&MockClientManager{Err: &nodemanager.RPCError{Code: -32099, Message: "rejected"}}).EstimateGasHandler().ServeHTTP(rr, httptest.NewRequest("POST", "/eth/estimate-gas", strings.NewReader(`{"to":"0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unmapped estimate rejection, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestProxyHandlerStaleHeader verifies stale balances are flagged in the X-Cache header
+func TestProxyHandlerStaleHeader(t *testing.T) {
+	handler := NewAPIHandler(&MockClientManager{Balance: "0x7", Cached: true, Stale: true})
+
+	rr := httptest.NewRecorder()
+	handler.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", nil))
+
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Cache") != "STALE" {
+		t.Fatalf("Expected a 200 flagged X-Cache: STALE, got %d %q", rr.Code, rr.Header().Get("X-Cache"))
+	}
+}
+
+// TestProxyHandlerCacheHeaders verifies X-Cache marks hits and misses and X-Eth-Node names the node that served each balance
+func TestProxyHandlerCacheHeaders(t *testing.T) {
+	for cached, expected := range map[bool]string{true: "HIT", false: "MISS"} {
+		rr := httptest.NewRecorder()
+		NewAPIHandler(&MockClientManager{Balance: "0x7", Cached: cached}).ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", nil))
+
+		if rr.Header().Get("X-Cache") != expected {
+			t.Errorf("Expected X-Cache %s, got %q", expected, rr.Header().Get("X-Cache"))
+		}
+		if node := rr.Header().Get(NodeHeader); node != "MockNode" {
+			t.Errorf("Expected %s MockNode, got %q", NodeHeader, node)
+		}
+	}
+
+	// A cached balance names the node it was fetched from, not whichever node served last.
+	servers := make([]nodemanager.NodeConfig, 0, 2)
+	for _, name := range []string{"A", "B"} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+		}))
+		defer server.Close()
+		servers = append(servers, nodemanager.NodeConfig{Name: name, URL: server.URL})
+	}
+	handler := NewAPIHandler(nodemanager.NewClientManager(servers, &http.Client{})).ProxyHandler()
+	for _, step := range []struct{ address, cache, node string }{
+		{"0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", "MISS", "A"},
+		{"0x94cdB19C6c3B22a6eEa7160636F2426E02Bc3b58", "MISS", "B"},
+		{"0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", "HIT", "A"},
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/"+step.address, nil))
+		if rr.Header().Get("X-Cache") != step.cache || rr.Header().Get(NodeHeader) != step.node {
+			t.Errorf("%s: expected X-Cache %s from node %s, got %q from %q", step.address, step.cache, step.node, rr.Header().Get("X-Cache"), rr.Header().Get(NodeHeader))
+		}
+	}
+}
+
+// TestProxyHandlerTimingHeader verifies a cache miss reports every phase in X-Timing when DEBUG_TIMING is set
+func TestProxyHandlerTimingHeader(t *testing.T) {
+	mockServer := mockEthereumNode(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`, http.StatusOK)
+	defer mockServer.Close()
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	handler := NewAPIHandler(manager).ProxyHandler()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", nil))
+	if header := rr.Header().Get(TimingHeader); header != "" {
+		t.Errorf("Expected no %s header without DEBUG_TIMING, got %q", TimingHeader, header)
+	}
+
+	setEnv(t, "DEBUG_TIMING", "true")
+	defer unsetEnv(t, "DEBUG_TIMING")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x5E447e8ecAAaaF0a2fe87fd0B6CF3C02DfBC336f", nil))
+
+	header := rr.Header().Get(TimingHeader)
+	for _, phase := range []string{"validation=", "cache=", "select=", "upstream="} {
+		if !strings.Contains(header, phase) {
+			t.Errorf("Expected %s in %s %q", phase, TimingHeader, header)
+		}
+	}
+}
+
+// TestProxyHandlerRequireFresh verifies strict clients get a 503 instead of a fresh cached balance while every node is down
+func TestProxyHandlerRequireFresh(t *testing.T) {
+	var down int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x7"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	handler := NewAPIHandler(manager).ProxyHandler()
+	path := "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+
+	// Warm the cache, then take the only node down.
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	atomic.StoreInt32(&down, 1)
+	manager.CheckAllNodes(context.Background())
+
+	strict := httptest.NewRequest("GET", path, nil)
+	strict.Header.Set(RequireFreshHeader, "true")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, strict)
+	if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "UPSTREAM_UNAVAILABLE") {
+		t.Errorf("Expected 503 UPSTREAM_UNAVAILABLE with %s, got %d %s", RequireFreshHeader, rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	if expected := `{"balance":"0x7"}`; rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != expected {
+		t.Errorf("Expected the cached balance without %s, got %d %s", RequireFreshHeader, rr.Code, rr.Body.String())
+	}
+}
+
 // TestGetBalance tests the GetBalance function of the ClientManager
 func TestGetBalance(t *testing.T) {
 	// Start a mock Ethereum node server
@@ -233,3 +857,1124 @@ func jsonEqual(a, b interface{}) bool {
 	bjson, _ := json.Marshal(b)
 	return string(ajson) == string(bjson)
 }
+
+// TestRequestIDCustomHeader verifies a custom request-ID header is read, echoed and forwarded upstream
+func TestRequestIDCustomHeader(t *testing.T) {
+	setEnv(t, "REQUEST_ID_HEADER", "X-Correlation-ID")
+	defer unsetEnv(t, "REQUEST_ID_HEADER")
+
+	forwarded := make(chan string, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded <- r.Header.Get("X-Correlation-ID")
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	handler := RequestID(NewAPIHandler(manager).ProxyHandler())
+
+	req := httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", nil)
+	req.Header.Set("X-Correlation-ID", "corr-123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if echoed := rr.Header().Get("X-Correlation-ID"); echoed != "corr-123" {
+		t.Errorf("Expected request ID to be echoed, got %q", echoed)
+	}
+	if upstream := <-forwarded; upstream != "corr-123" {
+		t.Errorf("Expected request ID to be forwarded upstream, got %q", upstream)
+	}
+}
+
+// TestProxyHandlerCacheLatencyLabels verifies request latency is observed under both cache labels
+func TestProxyHandlerCacheLatencyLabels(t *testing.T) {
+	before := map[string]uint64{"hit": histogramCount(t, MethodGetBalance, "hit"), "miss": histogramCount(t, MethodGetBalance, "miss")}
+
+	for _, cached := range []bool{false, true} {
+		handler := NewAPIHandler(&MockClientManager{Balance: "0x1", Cached: cached})
+		req := httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", nil)
+		handler.ProxyHandler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	for label, count := range before {
+		if got := histogramCount(t, MethodGetBalance, label); got != count+1 {
+			t.Errorf("Expected one new observation for cache=%s, got %d", label, got-count)
+		}
+	}
+}
+
+// TestRequestDurationMethodLabels verifies each endpoint records latency under its JSON-RPC method
+func TestRequestDurationMethodLabels(t *testing.T) {
+	balanceBefore := histogramCount(t, MethodGetBalance, "miss")
+	codeBefore := histogramCount(t, MethodGetCode, cacheNone)
+	handler := NewAPIHandler(&MockClientManager{Balance: "0x1"})
+
+	handler.ProxyHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", nil))
+	if got := histogramCount(t, MethodGetBalance, "miss"); got != balanceBefore+1 {
+		t.Errorf("Expected one new %s observation for a balance request, got %d", MethodGetBalance, got-balanceBefore)
+	}
+	if got := histogramCount(t, MethodGetCode, cacheNone); got != codeBefore {
+		t.Errorf("Expected no %s observation for a balance request, got %d", MethodGetCode, got-codeBefore)
+	}
+
+	handler.CodeHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/eth/code/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", nil))
+	if got := histogramCount(t, MethodGetCode, cacheNone); got != codeBefore+1 {
+		t.Errorf("Expected one new %s observation for a code request, got %d", MethodGetCode, got-codeBefore)
+	}
+	if got := histogramCount(t, MethodGetBalance, "miss"); got != balanceBefore+1 {
+		t.Errorf("Expected no further %s observation for a code request, got %d", MethodGetBalance, got-balanceBefore-1)
+	}
+}
+
+// histogramCount returns the number of observations recorded for a method and cache label
+func histogramCount(t *testing.T, method string, label string) uint64 {
+	t.Helper()
+	var metric dto.Metric
+	if err := RequestDuration.WithLabelValues(method, label).(prometheus.Histogram).Write(&metric); err != nil {
+		t.Fatalf("Failed to read histogram: %v", err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+// TestConsensusHandlerDisagreement verifies disagreeing nodes are reported by the consensus endpoint
+func TestConsensusHandlerDisagreement(t *testing.T) {
+	nodeA := mockEthereumNode(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`, http.StatusOK)
+	defer nodeA.Close()
+	nodeB := mockEthereumNode(`{"jsonrpc":"2.0","id":1,"result":"0x20"}`, http.StatusOK)
+	defer nodeB.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{
+		{Name: "NodeA", URL: nodeA.URL},
+		{Name: "NodeB", URL: nodeB.URL},
+	}, &http.Client{})
+
+	req := httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D/consensus", nil)
+	rr := httptest.NewRecorder()
+	NewAPIHandler(manager).ConsensusHandler().ServeHTTP(rr, req)
+
+	var report struct {
+		Agree bool                      `json:"agree"`
+		Nodes []nodemanager.NodeBalance `json:"nodes"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode consensus report: %v", err)
+	}
+
+	if report.Agree {
+		t.Errorf("Expected nodes to disagree, got %v", rr.Body.String())
+	}
+	if len(report.Nodes) != 2 || report.Nodes[0].Balance != "0x10" || report.Nodes[1].Balance != "0x20" {
+		t.Errorf("Expected each node's balance to be reported, got %+v", report.Nodes)
+	}
+}
+
+// TestVerifyHandlerFlagsDeviatingNode verifies a node disagreeing with the majority is flagged
+func TestVerifyHandlerFlagsDeviatingNode(t *testing.T) {
+	node := func(balance string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"` + balance + `"}`))
+		}))
+	}
+	first, second, deviating := node("0x10"), node("0x10"), node("0x99")
+	defer first.Close()
+	defer second.Close()
+	defer deviating.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{
+		{Name: "First", URL: first.URL},
+		{Name: "Second", URL: second.URL},
+		{Name: "Deviating", URL: deviating.URL},
+	}, &http.Client{})
+	address := "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+	// Round-robin sends the first lookup to the first node, caching the majority balance.
+	if _, err := manager.GetBalanceAt(context.Background(), address, "latest"); err != nil {
+		t.Fatalf("GetBalanceAt failed: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	NewAPIHandler(manager).VerifyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/admin/verify/"+address, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var report struct {
+		Majority     string   `json:"majority"`
+		Deviating    []string `json:"deviating"`
+		CacheMatches *bool    `json:"cacheMatches"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.Majority != "0x10" || !reflect.DeepEqual(report.Deviating, []string{"Deviating"}) {
+		t.Errorf("Expected majority 0x10 with Deviating flagged, got %+v", report)
+	}
+	if report.CacheMatches == nil || !*report.CacheMatches {
+		t.Errorf("Expected the cached balance to match the majority, got %v", report.CacheMatches)
+	}
+}
+
+// TestBalancesHandler verifies batch lookups return per-address balances and errors
+func TestBalancesHandler(t *testing.T) {
+	handler := NewAPIHandler(&MockClientManager{Balance: "0x1"}).BalancesHandler()
+
+	body := `["0x5E447e8ecAAaaF0a2fe87fd0B6CF3C02DfBC336f","0xInvalid","0x94cdB19C6c3B22a6eEa7160636F2426E02Bc3b58"]`
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/eth/balances", strings.NewReader(body)))
+
+	expected := `{"0x5E447e8ecAAaaF0a2fe87fd0B6CF3C02DfBC336f":{"balance":"0x1"},"0x94cdB19C6c3B22a6eEa7160636F2426E02Bc3b58":{"balance":"0x1"},"0xInvalid":{"error":"malformed address"}}`
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != expected {
+		t.Fatalf("Unexpected batch response: %d %s", rr.Code, rr.Body.String())
+	}
+
+	setEnv(t, "BATCH_MAX_ADDRESSES", "1")
+	defer unsetEnv(t, "BATCH_MAX_ADDRESSES")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/eth/balances", strings.NewReader(body)))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for an oversized batch, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+}
+
+// TestBalancesHandlerStream verifies NDJSON batch results arrive line by line as lookups complete
+// and that a client disconnect cancels the remaining lookups
+func TestBalancesHandlerStream(t *testing.T) {
+	mock := &MockClientManager{Stream: make(chan nodemanager.AddressBalance)}
+	server := httptest.NewServer(NewAPIHandler(mock).BalancesHandler())
+	defer server.Close()
+
+	first, second := "0x5E447e8ecAAaaF0a2fe87fd0B6CF3C02DfBC336f", "0x94cdB19C6c3B22a6eEa7160636F2426E02Bc3b58"
+	body := `["` + first + `","0xInvalid","` + second + `"]`
+	request, _ := http.NewRequest("POST", server.URL, strings.NewReader(body))
+	request.Header.Set("Accept", "application/x-ndjson")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("Unexpected stream response: %d %s", response.StatusCode, response.Header.Get("Content-Type"))
+	}
+
+	lines := bufio.NewReader(response.Body)
+	readLine := func() nodemanager.AddressBalance {
+		line, err := lines.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("Failed to read stream line: %v", err)
+		}
+		var result nodemanager.AddressBalance
+		if err := json.Unmarshal(line, &result); err != nil {
+			t.Fatalf("Invalid stream line %q: %v", line, err)
+		}
+		return result
+	}
+
+	seen := make(map[string]nodemanager.AddressBalance)
+	record := func(result nodemanager.AddressBalance) { seen[result.Address] = result }
+	record(readLine())
+
+	// Each result must be readable before the next lookup has completed.
+	mock.Stream <- nodemanager.AddressBalance{Address: second, Balance: "0x2"}
+	record(readLine())
+	mock.Stream <- nodemanager.AddressBalance{Address: first, Balance: "0x1"}
+	record(readLine())
+	close(mock.Stream)
+	if _, err := lines.ReadBytes('\n'); err != io.EOF {
+		t.Errorf("Expected the stream to end after every address, got %v", err)
+	}
+
+	expected := map[string]nodemanager.AddressBalance{
+		first:       {Address: first, Balance: "0x1"},
+		second:      {Address: second, Balance: "0x2"},
+		"0xInvalid": {Address: "0xInvalid", Error: "malformed address"},
+	}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Errorf("Unexpected streamed results: %v", seen)
+	}
+
+	// Disconnecting mid-stream cancels the lookups still pending.
+	mock = &MockClientManager{Stream: make(chan nodemanager.AddressBalance), StreamCtx: make(chan context.Context, 1)}
+	server = httptest.NewServer(NewAPIHandler(mock).BalancesHandler())
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	request, _ = http.NewRequestWithContext(ctx, "POST", server.URL, strings.NewReader(`["`+first+`"]`))
+	request.Header.Set("Accept", "application/x-ndjson")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	streamCtx := <-mock.StreamCtx
+	cancel()
+	response.Body.Close()
+	select {
+	case <-streamCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected disconnecting to cancel the pending lookups")
+	}
+}
+
+// TestWarmHandler verifies warmed addresses are subsequently served from cache
+func TestWarmHandler(t *testing.T) {
+	var calls int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	api := NewAPIHandler(manager)
+	addresses := []string{"0x5E447e8ecAAaaF0a2fe87fd0B6CF3C02DfBC336f", "0x94cdB19C6c3B22a6eEa7160636F2426E02Bc3b58"}
+
+	// Repeated entries are counted once.
+	body := `{"addresses":["` + strings.Join(append(addresses, "0xInvalid", "0xInvalid", addresses[0]), `","`) + `"]}`
+	rr := httptest.NewRecorder()
+	api.WarmHandler().ServeHTTP(rr, httptest.NewRequest("POST", "/admin/warm", strings.NewReader(body)))
+
+	expectedSummary := `{"errors":{"0xInvalid":"malformed address"},"failed":1,"succeeded":2}`
+	if rr.Code != http.StatusOK || rr.Body.String() != expectedSummary {
+		t.Fatalf("Unexpected warm response: %d %s", rr.Code, rr.Body.String())
+	}
+	warmedCalls := atomic.LoadInt32(&calls)
+
+	for _, address := range addresses {
+		rr := httptest.NewRecorder()
+		api.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/"+address, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected warmed address %s to be served, got %d", address, rr.Code)
+		}
+	}
+
+	if got := atomic.LoadInt32(&calls); got != warmedCalls {
+		t.Fatalf("Expected warmed addresses to be served from cache, node was called %d more times", got-warmedCalls)
+	}
+}
+
+// TestCacheOldestHandlers verifies the oldest cached balances are reported and refreshed first
+func TestCacheOldestHandlers(t *testing.T) {
+	var calls int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	api := NewAPIHandler(manager)
+	addresses := []string{
+		"0x5E447e8ecAAaaF0a2fe87fd0B6CF3C02DfBC336f",
+		"0x94cdB19C6c3B22a6eEa7160636F2426E02Bc3b58",
+		"0x00a3Ac5E156B4B291ceB59D019121beB6508d93D",
+	}
+	manager.GetBalances(context.Background(), addresses)
+
+	// Age the entries so addresses[0] is the oldest and addresses[2] the newest.
+	for key, item := range manager.Cache {
+		for i, address := range addresses {
+			if strings.Contains(item.Key, address) {
+				item.Timestamp = time.Now().Add(-time.Duration(30-10*i) * time.Second)
+				manager.Cache[key] = item
+			}
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	api.CacheOldestHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/admin/cache/oldest?n=2", nil))
+	var oldest struct {
+		Entries []nodemanager.CacheEntryAge `json:"entries"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &oldest); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("Unexpected response: %d %s", rr.Code, rr.Body.String())
+	}
+	if len(oldest.Entries) != 2 || oldest.Entries[0].Address != addresses[0] || oldest.Entries[1].Address != addresses[1] {
+		t.Fatalf("Expected the two oldest addresses, got %+v", oldest.Entries)
+	}
+	if oldest.Entries[0].AgeSeconds < 29 {
+		t.Errorf("Expected the oldest entry to be about 30s old, got %v", oldest.Entries[0].AgeSeconds)
+	}
+
+	before := atomic.LoadInt32(&calls)
+	rr = httptest.NewRecorder()
+	api.CacheRefreshOldestHandler().ServeHTTP(rr, httptest.NewRequest("POST", "/admin/cache/refresh-oldest?n=2", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Unexpected refresh response: %d %s", rr.Code, rr.Body.String())
+	}
+	if got := atomic.LoadInt32(&calls) - before; got != 2 {
+		t.Errorf("Expected 2 upstream refreshes, got %d", got)
+	}
+
+	// The newest entry is now the oldest.
+	if entries := manager.OldestCacheEntries(1); len(entries) != 1 || entries[0].Address != addresses[2] {
+		t.Errorf("Expected %s to be the oldest after the refresh, got %+v", addresses[2], entries)
+	}
+
+	rr = httptest.NewRecorder()
+	api.CacheOldestHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/admin/cache/oldest?n=0", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for n=0, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestStorageHandler verifies storage reads build eth_getStorageAt params and validate the slot
+func TestStorageHandler(t *testing.T) {
+	params := make(chan string, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		params <- payload.Method + " " + string(payload.Params)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x000000000000000000000000000000000000000000000000000000000000002A"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	api := NewAPIHandler(manager)
+
+	rr := httptest.NewRecorder()
+	api.StorageHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/storage/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D/0x2?block=finalized", nil))
+
+	if expected := `{"value":"0x000000000000000000000000000000000000000000000000000000000000002a"}`; rr.Code != http.StatusOK || rr.Body.String() != expected {
+		t.Fatalf("Expected %s, got %d %s", expected, rr.Code, rr.Body.String())
+	}
+	if got, expected := <-params, `eth_getStorageAt ["0x00a3Ac5E156B4B291ceB59D019121beB6508d93D","0x2","finalized"]`; got != expected {
+		t.Errorf("Expected call %s, got %s", expected, got)
+	}
+
+	for _, path := range []string{
+		"/eth/storage/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D/0xzz",
+		"/eth/storage/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D/2",
+		"/eth/storage/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D",
+	} {
+		rr := httptest.NewRecorder()
+		api.StorageHandler().ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "INVALID_SLOT") {
+			t.Errorf("%s: expected an INVALID_SLOT 400, got %d %s", path, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// TestTokenBalanceHandler verifies balanceOf is encoded for the holder and its result decoded
+func TestTokenBalanceHandler(t *testing.T) {
+	params := make(chan string, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		params <- payload.Method + " " + string(payload.Params)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x00000000000000000000000000000000000000000000000000000000000F4240"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	api := NewAPIHandler(manager)
+
+	rr := httptest.NewRecorder()
+	api.TokenBalanceHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/token-balance/0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?format=decimal", nil))
+
+	if expected := `{"balance":"0xf4240","decimal":"1000000"}`; rr.Code != http.StatusOK || rr.Body.String() != expected {
+		t.Fatalf("Expected %s, got %d %s", expected, rr.Code, rr.Body.String())
+	}
+	expectedCall := `eth_call [{"data":"0x70a0823100000000000000000000000000a3ac5e156b4b291ceb59d019121beb6508d93d","to":"0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"},"latest"]`
+	if got := <-params; got != expectedCall {
+		t.Errorf("Expected call %s, got %s", expectedCall, got)
+	}
+
+	rr = httptest.NewRecorder()
+	api.TokenBalanceHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/token-balance/0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48/0xInvalid", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid holder, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestGasPriceHandler verifies the gas price is cached between requests and converted on request
+func TestGasPriceHandler(t *testing.T) {
+	var calls int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x3b9aca01"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	handler := NewAPIHandler(manager).GasPriceHandler()
+
+	for query, expected := range map[string]string{"": `{"gasPrice":"0x3b9aca01"}`, "?unit=gwei": `{"gasPrice":"1.000000001"}`} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/gas-price"+query, nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != expected {
+			t.Errorf("Expected %s for %q, got %d %s", expected, query, rr.Code, rr.Body.String())
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Expected 1 upstream call within the cache window, got %d", got)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/gas-price?unit=finney", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unknown unit, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestNonceHandler verifies nonces are cached at latest but always fetched for pending
+func TestNonceHandler(t *testing.T) {
+	var calls int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1a"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	handler := NewAPIHandler(manager).NonceHandler()
+	path := "/eth/nonce/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+
+	for _, query := range []string{"", "?format=decimal", "?block=pending", "?block=pending"} {
+		expected := `{"nonce":"0x1a"}`
+		if query == "?format=decimal" {
+			expected = `{"nonce":"26"}`
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path+query, nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != expected {
+			t.Errorf("Expected %s for %q, got %d %s", expected, query, rr.Code, rr.Body.String())
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("Expected 1 upstream call for latest and 2 for pending, got %d", got)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/eth/nonce/0xInvalid", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid address, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestCodeHandler verifies contracts and EOAs are told apart and bytecode is served from cache
+func TestCodeHandler(t *testing.T) {
+	contract := "0x5E447e8ecAAaaF0a2fe87fd0B6CF3C02DfBC336f"
+	var calls int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), contract) {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x6080604052"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	api := NewAPIHandler(manager)
+
+	for _, tc := range []struct {
+		address  string
+		expected string
+	}{
+		{contract, `{"code":"0x6080604052"}`},
+		{"0x94cdB19C6c3B22a6eEa7160636F2426E02Bc3b58", `{"code":"0x"}`},
+		{contract, `{"code":"0x6080604052"}`},
+	} {
+		rr := httptest.NewRecorder()
+		api.CodeHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/code/"+tc.address, nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != tc.expected {
+			t.Errorf("%s: expected %s, got %d %s", tc.address, tc.expected, rr.Code, rr.Body.String())
+		}
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Expected the repeated lookup to be served from cache, node was called %d times", got)
+	}
+}
+
+// TestProxyHandlerPinnedBlock verifies a pinned block is honored across reads while the chain advances
+func TestProxyHandlerPinnedBlock(t *testing.T) {
+	var head int32 = 0x10
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload.Method == "eth_blockNumber" {
+			_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"0x%x"}`, atomic.LoadInt32(&head))
+			return
+		}
+		// The balance grows with the block it is read at.
+		block := payload.Params[1].(string)
+		if block == "latest" {
+			block = fmt.Sprintf("0x%x", atomic.LoadInt32(&head))
+		}
+		_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"%s00"}`, block)
+	}))
+	defer mockServer.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	api := NewAPIHandler(manager)
+	address := "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+
+	rr := httptest.NewRecorder()
+	api.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/"+address+"?pin=true", nil))
+	if expected := `{"balance":"0x1000","block":"0x10"}`; rr.Code != http.StatusOK || rr.Body.String() != expected {
+		t.Fatalf("Expected %s, got %d %s", expected, rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get(BlockNumberHeader) != "0x10" {
+		t.Errorf("Expected %s: 0x10, got %q", BlockNumberHeader, rr.Header().Get(BlockNumberHeader))
+	}
+
+	atomic.StoreInt32(&head, 0x11)
+	for _, address := range []string{address, "0x5E447e8ecAAaaF0a2fe87fd0B6CF3C02DfBC336f"} {
+		rr := httptest.NewRecorder()
+		api.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/"+address+"?block=0x10", nil))
+		if expected := `{"balance":"0x1000"}`; rr.Code != http.StatusOK || rr.Body.String() != expected {
+			t.Errorf("%s: expected the pinned read %s, got %d %s", address, expected, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	api.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/"+address+"?block=0x010", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected a block number with leading zeros to be rejected, got %d", rr.Code)
+	}
+}
+
+// TestProxyHandlerUsdQuote verifies ?quote=usd converts the balance using the price feed
+func TestProxyHandlerUsdQuote(t *testing.T) {
+	// 2000 USD with 8 decimals, as the second word of latestRoundData().
+	answer := fmt.Sprintf("%064x", 2000*100000000)
+	roundData := "0x" + strings.Repeat("0", 64) + answer + strings.Repeat("0", 3*64)
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Method string `json:"method"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		switch payload.Method {
+		case "eth_getBalance":
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1bc16d674ec80000"}`)) // 2 ETH
+		case "eth_call":
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"` + roundData + `"}`))
+		}
+	}))
+	defer mockServer.Close()
+
+	setEnv(t, "PRICE_FEED_ADDRESS", "0x694AA1769357215DE4FAC081bf1f309aDC325306")
+	defer unsetEnv(t, "PRICE_FEED_ADDRESS")
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	rr := httptest.NewRecorder()
+	NewAPIHandler(manager).ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?quote=usd", nil))
+
+	if expected := `{"eth":"2","usd":"4000.00"}`; rr.Code != http.StatusOK || rr.Body.String() != expected {
+		t.Fatalf("Expected %s, got %d %s", expected, rr.Code, rr.Body.String())
+	}
+}
+
+// TestProxyHandlerUsdQuoteOracleFailure verifies the balance is still returned when the oracle fails
+func TestProxyHandlerUsdQuoteOracleFailure(t *testing.T) {
+	handler := NewAPIHandler(&MockClientManager{Balance: "0x6f05b59d3b20000"}) // 0.5 ETH
+
+	rr := httptest.NewRecorder()
+	handler.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?quote=usd", nil))
+
+	if expected := `{"eth":"0.5"}`; rr.Code != http.StatusOK || rr.Body.String() != expected {
+		t.Fatalf("Expected %s, got %d %s", expected, rr.Code, rr.Body.String())
+	}
+}
+
+// TestProxyHandlerInvalidAddressCounter verifies rejected addresses are counted and valid ones are not
+func TestProxyHandlerInvalidAddressCounter(t *testing.T) {
+	handler := NewAPIHandler(&MockClientManager{Balance: "0x1"})
+	read := func() float64 {
+		var metric dto.Metric
+		if err := InvalidAddressTotal.WithLabelValues("MALFORMED_ADDRESS").Write(&metric); err != nil {
+			t.Fatalf("Failed to read counter: %v", err)
+		}
+		return metric.GetCounter().GetValue()
+	}
+
+	before := read()
+	rr := httptest.NewRecorder()
+	handler.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0xInvalid", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if got := read() - before; got != 1 {
+		t.Errorf("Expected the invalid address to be counted once, got %v", got)
+	}
+
+	before = read()
+	rr = httptest.NewRecorder()
+	handler.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if got := read() - before; got != 0 {
+		t.Errorf("Expected a valid address not to be counted, got %v", got)
+	}
+}
+
+// TestRecoverPanic verifies a panicking handler yields a clean 500 and is counted
+func TestRecoverPanic(t *testing.T) {
+	var before dto.Metric
+	if err := PanicsTotal.Write(&before); err != nil {
+		t.Fatalf("Failed to read counter: %v", err)
+	}
+
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var node *nodemanager.EthereumNode
+		_ = node.Name // nil pointer dereference
+	})
+
+	rr := httptest.NewRecorder()
+	Recover(panicking).ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x1", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	if expected := `{"error":"Internal server error"}`; rr.Body.String() != expected {
+		t.Errorf("Expected body %s, got %s", expected, rr.Body.String())
+	}
+
+	var after dto.Metric
+	if err := PanicsTotal.Write(&after); err != nil {
+		t.Fatalf("Failed to read counter: %v", err)
+	}
+	if got := after.GetCounter().GetValue() - before.GetCounter().GetValue(); got != 1 {
+		t.Errorf("Expected panics counter to increase by 1, got %v", got)
+	}
+}
+
+// TestProxyHandlerPathNormalization verifies slash variants and percent-encoded addresses are handled consistently
+func TestProxyHandlerPathNormalization(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "No trailing slash",
+			path:         "/eth/balance",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"code":"MISSING_ADDRESS","error":"missing address"}`,
+		},
+		{
+			name:         "Empty address",
+			path:         "/eth/balance/",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"code":"MISSING_ADDRESS","error":"missing address"}`,
+		},
+		{
+			name:         "Percent-encoded address",
+			path:         "/eth/balance/%30x00a3Ac5E156B4B291ceB59D019121beB6508d93D",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"balance":"0x1234"}`,
+		},
+		{
+			name:         "Trailing slash after address",
+			path:         "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D/",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"balance":"0x1234"}`,
+		},
+		{
+			name:         "Encoded slash in address",
+			path:         "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB%2F08d93D",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"code":"MALFORMED_ADDRESS","error":"malformed address"}`,
+		},
+	}
+
+	handler := NewAPIHandler(&MockClientManager{Balance: "0x1234"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+			if strings.TrimSpace(rr.Body.String()) != tt.expectedBody {
+				t.Errorf("Expected body %s, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestProxyHandlerTimeoutHeader verifies X-Timeout-Ms bounds how long a balance lookup may take
+func TestProxyHandlerTimeoutHeader(t *testing.T) {
+	slowNode := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1234"}`))
+	}))
+	defer slowNode.Close()
+
+	tests := []struct {
+		name         string
+		timeout      string
+		expectedCode int
+	}{
+		{name: "Short timeout", timeout: "50", expectedCode: http.StatusGatewayTimeout},
+		{name: "Long timeout", timeout: "2000", expectedCode: http.StatusOK},
+		{name: "Invalid timeout", timeout: "soon", expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A fresh manager per case keeps the balance out of the cache.
+			manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "SlowNode", URL: slowNode.URL}}, &http.Client{})
+
+			req := httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", nil)
+			req.Header.Set(TimeoutHeader, tt.timeout)
+			rr := httptest.NewRecorder()
+			NewAPIHandler(manager).ProxyHandler().ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedCode, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestOpenAPIHandler verifies the served spec is an OpenAPI 3 document covering the balance route
+func TestOpenAPIHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	OpenAPIHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/openapi.json", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Info    map[string]interface{}     `json:"info"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Expected valid JSON, got %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") || spec.Info["title"] == nil {
+		t.Errorf("Expected an OpenAPI 3 document, got openapi=%q info=%v", spec.OpenAPI, spec.Info)
+	}
+	for _, path := range []string{"/eth/balance/{address}", "/healthz", "/ready", "/openapi.json"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("Expected path %s to be documented", path)
+		}
+	}
+}
+
+// TestNewRouterEnabledEndpoints verifies ENABLED_ENDPOINTS and the write-endpoint default decide which routes are served
+func TestNewRouterEnabledEndpoints(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	routes := []Route{
+		{Pattern: "/eth/balance/", Handler: ok},
+		{Pattern: "/healthz", Handler: ok},
+		{Pattern: "/eth/send", Handler: ok, Write: true},
+	}
+
+	tests := []struct {
+		name     string
+		enabled  string
+		expected map[string]int
+	}{
+		{
+			name:    "Default",
+			enabled: "",
+			expected: map[string]int{
+				"/eth/balance/0x1": http.StatusOK,
+				"/healthz":         http.StatusOK,
+				"/eth/send":        http.StatusNotFound,
+			},
+		},
+		{
+			name:    "Explicit list",
+			enabled: "/eth/balance, /eth/send",
+			expected: map[string]int{
+				"/eth/balance/0x1": http.StatusOK,
+				"/healthz":         http.StatusNotFound,
+				"/eth/send":        http.StatusOK,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, "ENABLED_ENDPOINTS", tt.enabled)
+			defer unsetEnv(t, "ENABLED_ENDPOINTS")
+
+			router := NewRouter(routes)
+			for path, code := range tt.expected {
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+				if rr.Code != code {
+					t.Errorf("Expected %s to return %d, got %d", path, code, rr.Code)
+				}
+			}
+		})
+	}
+}
+
+// TestEstimateGasHandlerBuffer verifies ?buffer raises the estimate by the given percentage
+func TestEstimateGasHandlerBuffer(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode int
+		expectedBody string
+	}{
+		{name: "No buffer", query: "", expectedCode: http.StatusOK, expectedBody: `{"gas":"0x5208"}`},            // 21000
+		{name: "20 percent", query: "?buffer=20", expectedCode: http.StatusOK, expectedBody: `{"gas":"0x6270"}`}, // 25200
+		{name: "1 percent", query: "?buffer=1", expectedCode: http.StatusOK, expectedBody: `{"gas":"0x52da"}`},   // 21210
+		{name: "Invalid buffer", query: "?buffer=-5", expectedCode: http.StatusBadRequest},
+	}
+
+	handler := NewAPIHandler(&MockClientManager{Balance: "0x5208"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := strings.NewReader(`{"from":"0x00a3Ac5E156B4B291ceB59D019121beB6508d93D","to":"0x742d35Cc6634C0532925a3b844Bc454e4438f44e","value":"0x1"}`)
+			rr := httptest.NewRecorder()
+			handler.EstimateGasHandler().ServeHTTP(rr, httptest.NewRequest("POST", "/eth/estimate-gas"+tt.query, body))
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedCode, rr.Code, rr.Body.String())
+			}
+			if tt.expectedBody != "" && strings.TrimSpace(rr.Body.String()) != tt.expectedBody {
+				t.Errorf("Expected body %s, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestProxyHandlerDebugAttempts verifies admins can see every failed attempt with ?debug=true
+func TestProxyHandlerDebugAttempts(t *testing.T) {
+	nodeA := mockEthereumNode(`{}`, http.StatusBadGateway)
+	defer nodeA.Close()
+	nodeB := mockEthereumNode(`{}`, http.StatusServiceUnavailable)
+	defer nodeB.Close()
+
+	setEnv(t, "ADMIN_TOKEN", "secret")
+	defer unsetEnv(t, "ADMIN_TOKEN")
+	setEnv(t, "MAX_RETRIES", "1")
+	defer unsetEnv(t, "MAX_RETRIES")
+
+	newManager := func() *nodemanager.ClientManager {
+		return nodemanager.NewClientManager([]nodemanager.NodeConfig{
+			{Name: "NodeA", URL: nodeA.URL},
+			{Name: "NodeB", URL: nodeB.URL},
+		}, &http.Client{})
+	}
+
+	req := httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?debug=true", nil)
+	req.Header.Set(AdminTokenHeader, "secret")
+	rr := httptest.NewRecorder()
+	NewAPIHandler(newManager()).ProxyHandler().ServeHTTP(rr, req)
+
+	var body struct {
+		Error    string                     `json:"error"`
+		Attempts []nodemanager.AttemptError `json:"attempts"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected a JSON body, got %v", err)
+	}
+	if rr.Code != http.StatusInternalServerError || len(body.Attempts) != 2 {
+		t.Fatalf("Expected a 500 with 2 attempts, got %d %s", rr.Code, rr.Body.String())
+	}
+	expected := []nodemanager.AttemptError{
+		{Node: "NodeA", Error: "unexpected status code: 502"},
+		{Node: "NodeB", Error: "unexpected status code: 503"},
+	}
+	for i, attempt := range body.Attempts {
+		if attempt != expected[i] {
+			t.Errorf("Expected attempt %d to be %+v, got %+v", i, expected[i], attempt)
+		}
+	}
+
+	// Without the admin token the concise error is returned.
+	rr = httptest.NewRecorder()
+	NewAPIHandler(newManager()).ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?debug=true", nil))
+	if strings.Contains(rr.Body.String(), "attempts") {
+		t.Errorf("Expected no attempts for non-admin clients, got %s", rr.Body.String())
+	}
+}
+
+// TestProxyHandlerPendingBypassesCache verifies pending balances are always fetched from a node
+func TestProxyHandlerPendingBypassesCache(t *testing.T) {
+	var calls int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Params []string `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if len(payload.Params) != 2 || payload.Params[1] != "pending" {
+			t.Errorf("Expected the pending block tag to be forwarded, got %v", payload.Params)
+		}
+		n := atomic.AddInt32(&calls, 1)
+		_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"0x%x"}`, n)
+	}))
+	defer mockServer.Close()
+
+	manager := nodemanager.NewClientManager([]nodemanager.NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	handler := NewAPIHandler(manager)
+
+	for i := 1; i <= 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?block=pending", nil))
+		if expected := fmt.Sprintf(`{"balance":"0x%x"}`, i); strings.TrimSpace(rr.Body.String()) != expected {
+			t.Errorf("Expected request %d to return %s, got %s", i, expected, rr.Body.String())
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Expected both pending requests to hit the node, got %d calls", got)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ProxyHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?block=tomorrow", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid block, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestLimitConcurrencyPerKey verifies a key limited to one request rejects a second concurrent one
+func TestLimitConcurrencyPerKey(t *testing.T) {
+	setEnv(t, "API_KEY_CONCURRENCY", "basic=1,premium=5")
+	defer unsetEnv(t, "API_KEY_CONCURRENCY")
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	limited := LimitConcurrencyPerKey(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Only the first "basic" request blocks; the others complete immediately.
+		if req.URL.Query().Get("block") == "true" {
+			entered <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(key string, block bool) *http.Request {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/eth/balance/0x00a3Ac5E156B4B291ceB59D019121beB6508d93D?block=%t", block), nil)
+		req.Header.Set(APIKeyHeader(), key)
+		return req
+	}
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		limited.ServeHTTP(first, request("basic", true))
+		close(done)
+	}()
+	<-entered
+
+	second := httptest.NewRecorder()
+	limited.ServeHTTP(second, request("basic", false))
+	if second.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the second concurrent request to get %d, got %d", http.StatusTooManyRequests, second.Code)
+	}
+	assertShed(t, second, "TOO_MANY_CONCURRENT_REQUESTS", 1000, "1")
+
+	// Another key has its own allowance.
+	other := httptest.NewRecorder()
+	limited.ServeHTTP(other, request("premium", false))
+	if other.Code != http.StatusOK {
+		t.Errorf("Expected a request with another key to succeed, got %d", other.Code)
+	}
+
+	close(release)
+	<-done
+	if first.Code != http.StatusOK {
+		t.Errorf("Expected the first request to succeed, got %d", first.Code)
+	}
+}
+
+// TestLimitConcurrencyPerKeyDefaultBucket verifies unlisted keys share one default allowance
+func TestLimitConcurrencyPerKeyDefaultBucket(t *testing.T) {
+	setEnv(t, "API_KEY_DEFAULT_CONCURRENCY", "1")
+	defer unsetEnv(t, "API_KEY_DEFAULT_CONCURRENCY")
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	limited := LimitConcurrencyPerKey(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		req := httptest.NewRequest("GET", "/healthz", nil)
+		req.Header.Set(APIKeyHeader(), "random-1")
+		limited.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	<-entered
+
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	req.Header.Set(APIKeyHeader(), "random-2")
+	rr := httptest.NewRecorder()
+	limited.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected an unlisted key to share the default allowance, got %d", rr.Code)
+	}
+
+	close(release)
+	<-done
+}
+
+// TestChaos verifies injected delay and errors are only applied when chaos mode is enabled
+func TestChaos(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	serve := func(h http.Handler, n int) (failures int, elapsed time.Duration) {
+		start := time.Now()
+		for i := 0; i < n; i++ {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+			if rr.Code == http.StatusServiceUnavailable {
+				failures++
+			}
+		}
+		return failures, time.Since(start)
+	}
+
+	setEnv(t, "CHAOS_DELAY_MS", "50")
+	defer unsetEnv(t, "CHAOS_DELAY_MS")
+	setEnv(t, "CHAOS_ERROR_RATE", "100")
+	defer unsetEnv(t, "CHAOS_ERROR_RATE")
+
+	// Disabled unless explicitly enabled.
+	if failures, elapsed := serve(Chaos(ok), 5); failures != 0 || elapsed >= 50*time.Millisecond {
+		t.Errorf("Expected no chaos without CHAOS_ENABLED, got %d failures in %v", failures, elapsed)
+	}
+
+	setEnv(t, "CHAOS_ENABLED", "true")
+	defer unsetEnv(t, "CHAOS_ENABLED")
+
+	if failures, elapsed := serve(Chaos(ok), 2); failures != 2 || elapsed < 100*time.Millisecond {
+		t.Errorf("Expected every request to be delayed and fail, got %d failures in %v", failures, elapsed)
+	}
+
+	unsetEnv(t, "CHAOS_DELAY_MS")
+	setEnv(t, "CHAOS_ERROR_RATE", "30")
+	if failures, _ := serve(Chaos(ok), 1000); failures < 200 || failures > 400 {
+		t.Errorf("Expected about 30%% of requests to fail, got %d of 1000", failures)
+	}
+
+	// Never in production.
+	setEnv(t, "GO_ENV", "production")
+	defer unsetEnv(t, "GO_ENV")
+	if failures, _ := serve(Chaos(ok), 100); failures != 0 {
+		t.Errorf("Expected chaos mode to be refused in production, got %d failures", failures)
+	}
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Route is an endpoint the proxy can serve.
+type Route struct {
+	Pattern string       // ServeMux pattern, e.g. "/eth/balance/".
+	Handler http.Handler // Handler serving the pattern.
+	Write   bool         // Whether the endpoint changes chain state; write endpoints are off by default.
+}
+
+// NewRouter returns a ServeMux serving only the enabled routes; requests for any other path get a 404.
+func NewRouter(routes []Route) *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, route := range routes {
+		if EndpointEnabled(route) {
+			mux.Handle(route.Pattern, route.Handler)
+		}
+	}
+	return mux
+}
+
+// EndpointEnabled reports whether route should be served. ENABLED_ENDPOINTS lists the enabled
+// endpoints by path, comma-separated (e.g. "/eth/balance,/healthz"; a trailing slash is optional).
+// When it is unset, every read endpoint is enabled and every write endpoint disabled.
+func EndpointEnabled(route Route) bool {
+	enabled := os.Getenv("ENABLED_ENDPOINTS")
+	if enabled == "" {
+		return !route.Write
+	}
+
+	name := strings.TrimSuffix(route.Pattern, "/")
+	for _, endpoint := range strings.Split(enabled, ",") {
+		if strings.TrimSuffix(strings.TrimSpace(endpoint), "/") == name {
+			return true
+		}
+	}
+	return false
+}
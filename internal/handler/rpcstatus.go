@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"errors"
+	"github.com/luishsr/eth-proxy/internal/nodemanager"
+	"github.com/luishsr/eth-proxy/utils"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultRPCStatusCodes maps well-known JSON-RPC error codes to HTTP statuses.
+var defaultRPCStatusCodes = map[int]int{
+	-32600: http.StatusBadRequest,          // Invalid request.
+	-32602: http.StatusBadRequest,          // Invalid params.
+	-32601: http.StatusNotImplemented,      // Method not found.
+	-32005: http.StatusTooManyRequests,     // Limit exceeded (EIP-1474).
+	3:      http.StatusUnprocessableEntity, // Execution reverted.
+}
+
+// rpcErrorStatus returns the HTTP status for a JSON-RPC error code: its entry in RPC_STATUS_CODES
+// ("-32005=429,3=400") if any, else its default mapping. It reports false for unmapped codes.
+// Overrides let operators match their API gateway's conventions.
+func rpcErrorStatus(code int) (int, bool) {
+	for _, entry := range strings.Split(utils.GetEnv("RPC_STATUS_CODES"), ",") {
+		rawCode, rawStatus, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || strings.TrimSpace(rawCode) != strconv.Itoa(code) {
+			continue
+		}
+
+		status, err := strconv.Atoi(strings.TrimSpace(rawStatus))
+		if err != nil || status < 400 || status > 599 {
+			utils.Logger.WithField("entry", entry).Warn("Ignoring invalid RPC_STATUS_CODES entry")
+			break
+		}
+		return status, true
+	}
+
+	status, ok := defaultRPCStatusCodes[code]
+	return status, ok
+}
+
+// rpcStatus returns the HTTP status err maps to if it is a JSON-RPC error with a mapped code.
+func rpcStatus(err error) (int, bool) {
+	var rpcErr *nodemanager.RPCError
+	if !errors.As(err, &rpcErr) {
+		return 0, false
+	}
+	return rpcErrorStatus(rpcErr.Code)
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"errors"
+	"github.com/luishsr/eth-proxy/internal/nodemanager"
+	"github.com/luishsr/eth-proxy/utils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StorageHandler returns an http.HandlerFunc that reads a contract storage slot at
+// /eth/storage/{address}/{slot}?block=latest and responds with {"value":"0x..."}.
+func (api *APIHandler) StorageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		address, slot, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/eth/storage/"), "/")
+		if err := validateAddress(address); err != nil {
+			respondInvalidAddress(w, err)
+			return
+		}
+
+		block := req.URL.Query().Get("block")
+		if block == "" {
+			block = "latest"
+		}
+
+		start := time.Now()
+		value, err := api.manager.GetStorageAt(req.Context(), address, slot, block)
+		observeRequest(MethodGetStorageAt, cacheNone, start)
+		if err != nil {
+			if errors.Is(err, nodemanager.ErrInvalidSlot) {
+				utils.RespondErrorCode(w, http.StatusBadRequest, "INVALID_SLOT", err.Error())
+			} else {
+				respondLookupError(w, req, err)
+			}
+			return
+		}
+
+		utils.RespondJSON(w, http.StatusOK, map[string]string{"value": value})
+	}
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"github.com/luishsr/eth-proxy/utils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TokenBalanceHandler returns an http.HandlerFunc that fetches the ERC-20 balance at
+// /eth/token-balance/{token}/{holder}?block=latest and responds with {"balance":"0x..."}, in the
+// token's smallest unit. With ?format=decimal the balance is also returned as a base-10 string.
+func (api *APIHandler) TokenBalanceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, holder, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/eth/token-balance/"), "/")
+		for _, address := range []string{token, holder} {
+			if err := validateAddress(address); err != nil {
+				respondInvalidAddress(w, err)
+				return
+			}
+		}
+
+		format := req.URL.Query().Get("format")
+		if format != "" && format != "hex" && format != "decimal" {
+			utils.RespondErrorCode(w, http.StatusBadRequest, "INVALID_FORMAT", "invalid format: expected hex or decimal")
+			return
+		}
+
+		block := req.URL.Query().Get("block")
+		if block == "" {
+			block = "latest"
+		}
+
+		start := time.Now()
+		balance, err := api.manager.GetTokenBalance(req.Context(), token, holder, block)
+		observeRequest(MethodCall, cacheNone, start)
+		if err != nil {
+			respondLookupError(w, req, err)
+			return
+		}
+
+		response := map[string]string{"balance": balance}
+		if format == "decimal" {
+			decimal, err := utils.HexToDecimalString(balance)
+			if err != nil {
+				utils.RespondError(w, http.StatusInternalServerError, "Invalid balance returned by node")
+				return
+			}
+			response["decimal"] = decimal
+		}
+		utils.RespondJSON(w, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,75 @@
+package nodemanager
+
+import (
+	"context"
+	"errors"
+	"github.com/luishsr/eth-proxy/utils"
+	"strconv"
+)
+
+// ErrNoArchiveNode is returned for a historical query when no archive node is configured or none
+// is available.
+var ErrNoArchiveNode = errors.New("no healthy archive node available for historical queries")
+
+type archiveBlockKey struct{}
+
+// forBlock returns a copy of ctx whose calls read state at block, so they are routed to archive
+// nodes when block is historical (see requiresArchive).
+func forBlock(ctx context.Context, block string) context.Context {
+	return context.WithValue(ctx, archiveBlockKey{}, block)
+}
+
+// requiresArchive reports whether calls made with ctx must go to archive nodes: they read state at
+// "earliest" or at a block at least ARCHIVE_MIN_DEPTH (128 by default) below the head, which full
+// nodes may have pruned. Such calls fail with ErrNoArchiveNode when no node is configured as an
+// archive node.
+func (m *ClientManager) requiresArchive(ctx context.Context) (bool, error) {
+	block, _ := ctx.Value(archiveBlockKey{}).(string)
+	if !isHistoricalBlock(block) {
+		return false, nil
+	}
+	if block != "earliest" {
+		depth, err := m.blockDepth(ctx, block)
+		if err != nil {
+			return false, err
+		}
+		if depth < uint64(utils.GetEnvInt("ARCHIVE_MIN_DEPTH", 128)) {
+			return false, nil
+		}
+	}
+
+	if !m.hasArchiveNodes() {
+		return false, ErrNoArchiveNode
+	}
+	return true, nil
+}
+
+// blockDepth returns how many blocks the block number block lies below the current head (see
+// headBlock), 0 for the head itself or a block beyond it.
+func (m *ClientManager) blockDepth(ctx context.Context, block string) (uint64, error) {
+	number, err := strconv.ParseUint(block[2:], 16, 64)
+	if err != nil {
+		return 0, ErrInvalidBlock
+	}
+	head, err := m.headBlock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if number >= head {
+		return 0, nil
+	}
+	return head - number, nil
+}
+
+// hasArchiveNodes reports whether any node is configured as an archive node.
+func (m *ClientManager) hasArchiveNodes() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, node := range m.Nodes {
+		if node.Archive {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package nodemanager
+
+import (
+	"context"
+	"github.com/luishsr/eth-proxy/utils"
+	"sync"
+)
+
+// AddressBalance is the outcome of one address's lookup within a batch.
+type AddressBalance struct {
+	Address string `json:"address"`
+	Balance string `json:"balance,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// GetBalances fetches balances for several addresses concurrently, bounded by BATCH_CONCURRENCY,
+// returning one result per address in input order. Each lookup goes through the cache and the
+// usual retry logic, so a batch also populates the cache.
+func (m *ClientManager) GetBalances(ctx context.Context, addresses []string) []AddressBalance {
+	index := make(map[string][]int, len(addresses))
+	for i, address := range addresses {
+		index[address] = append(index[address], i)
+	}
+
+	results := make([]AddressBalance, len(addresses))
+	for result := range m.StreamBalances(ctx, addresses) {
+		positions := index[result.Address]
+		results[positions[0]] = result
+		index[result.Address] = positions[1:]
+	}
+	return results
+}
+
+// StreamBalances fetches balances like GetBalances but delivers each result on the returned
+// channel as soon as its lookup completes, closing the channel once all are done. Once ctx is
+// cancelled, lookups still waiting for a BATCH_CONCURRENCY slot are not started and report the
+// context error. The channel is buffered for every address, so callers may stop reading early.
+func (m *ClientManager) StreamBalances(ctx context.Context, addresses []string) <-chan AddressBalance {
+	results := make(chan AddressBalance, len(addresses))
+	semaphore := make(chan struct{}, utils.GetEnvInt("BATCH_CONCURRENCY", 8))
+	var wg sync.WaitGroup
+
+	for _, address := range addresses {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			result := AddressBalance{Address: address}
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				result.Error = ctx.Err().Error()
+				results <- result
+				return
+			}
+
+			balance, err := m.GetBalanceResult(ctx, address)
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Balance = balance.Balance
+			}
+			results <- result
+		}(address)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
@@ -0,0 +1,101 @@
+package nodemanager
+
+import (
+	"context"
+	"errors"
+	"github.com/luishsr/eth-proxy/utils"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidBlock is returned for a block parameter that is neither a supported block tag nor a block number.
+var ErrInvalidBlock = errors.New("invalid block: expected latest, pending, earliest, safe, finalized or a 0x-prefixed block number")
+
+// blockNumberPattern matches a block number as a lower-case hex quantity without leading zeros.
+var blockNumberPattern = regexp.MustCompile(`^0x(0|[1-9a-f][0-9a-f]*)$`)
+
+// blockTags are the block tags accepted by balance lookups.
+var blockTags = map[string]bool{
+	"latest":    true,
+	"pending":   true,
+	"earliest":  true,
+	"safe":      true,
+	"finalized": true,
+}
+
+// validateBlock checks that block is a supported block tag or a block number.
+func validateBlock(block string) error {
+	if !blockTags[block] && !blockNumberPattern.MatchString(block) {
+		return ErrInvalidBlock
+	}
+	return nil
+}
+
+// isHistoricalBlock reports whether results read at block can no longer change: block numbers
+// (barring reorgs) and "earliest".
+func isHistoricalBlock(block string) bool {
+	return block == "earliest" || blockNumberPattern.MatchString(block)
+}
+
+// BlockNumber returns the number of the most recent block, as a hex quantity.
+func (m *ClientManager) BlockNumber(ctx context.Context) (string, error) {
+	result, err := m.Call(ctx, "eth_blockNumber", []interface{}{})
+	if err != nil {
+		return "", err
+	}
+	return parseQuantity(result)
+}
+
+// blockCacheTTL returns how long a result read at block stays fresh: pending results are not
+// cached at all, historical results that a reorg can no longer replace (see recentBlock) are kept
+// for HISTORICAL_CACHE_EXPIRATION_SECONDS (a day by default) and the rest use
+// CACHE_EXPIRATION_SECONDS (60 by default).
+func (m *ClientManager) blockCacheTTL(ctx context.Context, block string) time.Duration {
+	if block == "pending" {
+		return 0
+	}
+	if isHistoricalBlock(block) && !m.recentBlock(ctx, block) {
+		return historicalCacheTTL()
+	}
+	return time.Duration(utils.GetEnvInt("CACHE_EXPIRATION_SECONDS", 60)) * time.Second
+}
+
+// historicalCacheTTL returns HISTORICAL_CACHE_EXPIRATION_SECONDS (a day by default).
+func historicalCacheTTL() time.Duration {
+	return time.Duration(utils.GetEnvInt("HISTORICAL_CACHE_EXPIRATION_SECONDS", 86400)) * time.Second
+}
+
+// recentBlock reports whether block is a block number less than REORG_SAFE_DEPTH (64 by default)
+// below the head, where a reorg may still replace it, e.g. one pinned with ?pin=true. A block is
+// assumed recent while the head cannot be read.
+func (m *ClientManager) recentBlock(ctx context.Context, block string) bool {
+	if !blockNumberPattern.MatchString(block) {
+		return false
+	}
+	depth, err := m.blockDepth(ctx, block)
+	return err != nil || depth < uint64(utils.GetEnvInt("REORG_SAFE_DEPTH", 64))
+}
+
+// headBlock returns the number of the most recent block, shared across requests and cached for
+// LATEST_BLOCK_CACHE_EXPIRATION_SECONDS (2 by default).
+func (m *ClientManager) headBlock(ctx context.Context) (uint64, error) {
+	ttl := time.Duration(utils.GetEnvInt("LATEST_BLOCK_CACHE_EXPIRATION_SECONDS", 2)) * time.Second
+
+	head, err := m.headCache.get(ctx, ttl, func(ctx context.Context) (interface{}, error) {
+		// The head is read at "latest", so looking it up never needs the head itself.
+		quantity, err := m.BlockNumber(forBlock(ctx, "latest"))
+		if err != nil {
+			return nil, err
+		}
+		number, err := strconv.ParseUint(quantity[2:], 16, 64)
+		if err != nil {
+			return nil, ErrInvalidQuantity
+		}
+		return number, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return head.(uint64), nil
+}
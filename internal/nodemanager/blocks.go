@@ -0,0 +1,69 @@
+package nodemanager
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/luishsr/eth-proxy/utils"
+	"strconv"
+	"time"
+)
+
+// GetBlockByNumber returns the block at number, a block tag or a hex or decimal block number, as
+// the node's JSON. With full, transactions are returned as objects rather than hashes. A block the
+// node does not know yields ErrNullResult. Blocks at a fixed number are cached like other
+// historical results (see blockCacheTTL), keeping at most BLOCK_CACHE_MAX_ENTRIES of them (1024 by
+// default); the latest ones for LATEST_BLOCK_CACHE_EXPIRATION_SECONDS (2 by default).
+func (m *ClientManager) GetBlockByNumber(ctx context.Context, number string, full bool) (json.RawMessage, error) {
+	if decimal, err := strconv.ParseUint(number, 10, 64); err == nil {
+		number = "0x" + strconv.FormatUint(decimal, 16)
+	}
+	if err := validateBlock(number); err != nil {
+		return nil, err
+	}
+
+	ttl := time.Duration(utils.GetEnvInt("LATEST_BLOCK_CACHE_EXPIRATION_SECONDS", 2)) * time.Second
+	if number == "pending" {
+		ttl = 0
+	} else if isHistoricalBlock(number) {
+		ttl = m.blockCacheTTL(ctx, number)
+	}
+
+	params := []interface{}{number, full}
+	block, err := m.cachedCall(ctx, "eth_getBlockByNumber", params, ttl, func(result json.RawMessage) (string, error) {
+		return string(result), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if isHistoricalBlock(number) {
+		m.trackBlockEntry(params)
+	}
+	return json.RawMessage(block), nil
+}
+
+// trackBlockEntry notes the numbered block cached for params, evicting the oldest numbered blocks
+// from the cache beyond BLOCK_CACHE_MAX_ENTRIES (1024 by default). Full blocks can be large and
+// timestamp lookups probe many of them, so they are capped separately from other entries.
+func (m *ClientManager) trackBlockEntry(params []interface{}) {
+	key, _ := cacheKey("eth_getBlockByNumber", params)
+	maxEntries := utils.GetEnvInt("BLOCK_CACHE_MAX_ENTRIES", 1024)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.blockEntries == nil {
+		m.blockEntries = make(map[string]bool)
+	}
+	if m.blockEntries[key] {
+		return
+	}
+	m.blockEntries[key] = true
+	m.blockOrder = append(m.blockOrder, key)
+
+	for len(m.blockOrder) > maxEntries {
+		oldest := m.blockOrder[0]
+		m.blockOrder = m.blockOrder[1:]
+		delete(m.blockEntries, oldest)
+		delete(m.Cache, oldest)
+	}
+}
@@ -0,0 +1,49 @@
+package nodemanager
+
+import (
+	"fmt"
+	"strings"
+)
+
+// standardBlockTags are the block tags defined by the JSON-RPC spec.
+var standardBlockTags = map[string]bool{"latest": true, "earliest": true, "pending": true, "safe": true, "finalized": true}
+
+// ParseBlockTagAliases parses comma-separated tag rewrites such as "finalized=safe,pending=latest"
+// for providers that expect block tags in a different case or under another name.
+func ParseBlockTagAliases(raw string) (map[string]string, error) {
+	var aliases map[string]string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		tag, alias, found := strings.Cut(entry, "=")
+		tag, alias = strings.ToLower(strings.TrimSpace(tag)), strings.TrimSpace(alias)
+		if !found || !standardBlockTags[tag] || alias == "" {
+			return nil, fmt.Errorf("invalid block tag alias %q: expected tag=alias with a standard block tag", entry)
+		}
+		if aliases == nil {
+			aliases = make(map[string]string)
+		}
+		aliases[tag] = alias
+	}
+	return aliases, nil
+}
+
+// aliasBlockTags returns params with standard block tags rewritten to the node's aliases, leaving
+// params untouched when the node has none.
+func (n *EthereumNode) aliasBlockTags(params []interface{}) []interface{} {
+	if len(n.BlockTagAliases) == 0 {
+		return params
+	}
+	rewritten := make([]interface{}, len(params))
+	for i, param := range params {
+		rewritten[i] = param
+		if tag, ok := param.(string); ok {
+			if alias, found := n.BlockTagAliases[tag]; found {
+				rewritten[i] = alias
+			}
+		}
+	}
+	return rewritten
+}
@@ -0,0 +1,146 @@
+package nodemanager
+
+import (
+	"errors"
+	"github.com/luishsr/eth-proxy/utils"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting any node while the global circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open: Ethereum providers are failing, shedding load")
+
+// CircuitOpenError is ErrCircuitOpen along with how long until the breaker lets a probe through.
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return ErrCircuitOpen.Error()
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// Global circuit breaker states, as reported by the CircuitBreakerState gauge.
+const (
+	breakerClosed   = 0
+	breakerOpen     = 1
+	breakerHalfOpen = 2
+)
+
+// circuitBreaker trips when the aggregate error rate of upstream attempts across all nodes exceeds
+// BREAKER_ERROR_RATE percent (50 by default) over BREAKER_WINDOW_SECONDS (10), once at least
+// BREAKER_MIN_REQUESTS (20) attempts were made. It then fails fast for BREAKER_OPEN_SECONDS (5)
+// before letting a single probe lookup through to decide whether to close again.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    int
+	openedAt time.Time
+	probing  bool        // Whether the half-open probe is in flight.
+	attempts []time.Time // Attempt times within the window.
+	failures []time.Time // Failed attempt times within the window.
+}
+
+// allow reports whether a lookup may proceed, and whether it is the half-open probe.
+func (b *circuitBreaker) allow() (allowed bool, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < time.Duration(utils.GetEnvInt("BREAKER_OPEN_SECONDS", 5))*time.Second {
+			return false, false
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return true, true
+	case breakerHalfOpen:
+		if b.probing {
+			return false, false
+		}
+		b.probing = true
+		return true, true
+	default:
+		return true, false
+	}
+}
+
+// retryAfter estimates how long until the breaker next admits a lookup: the rest of the open
+// period, or a second while a half-open probe is in flight.
+func (b *circuitBreaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen {
+		if remaining := time.Duration(utils.GetEnvInt("BREAKER_OPEN_SECONDS", 5))*time.Second - time.Since(b.openedAt); remaining > 0 {
+			return remaining
+		}
+	}
+	return time.Second
+}
+
+// record notes the outcome of an upstream attempt.
+func (b *circuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case breakerHalfOpen:
+		b.probing = false
+		if failed {
+			b.open(now)
+		} else {
+			b.attempts, b.failures = nil, nil
+			b.setState(breakerClosed)
+			utils.Logger.Info("Global circuit breaker closed, Ethereum providers recovered")
+		}
+		return
+	case breakerOpen:
+		return // Late result of an attempt started before the breaker opened.
+	}
+
+	window := time.Duration(utils.GetEnvInt("BREAKER_WINDOW_SECONDS", 10)) * time.Second
+	b.attempts = pruneBefore(append(b.attempts, now), now.Add(-window))
+	if failed {
+		b.failures = append(b.failures, now)
+	}
+	b.failures = pruneBefore(b.failures, now.Add(-window))
+
+	total, failures := len(b.attempts), len(b.failures)
+	if total >= utils.GetEnvInt("BREAKER_MIN_REQUESTS", 20) && failures*100 >= utils.GetEnvInt("BREAKER_ERROR_RATE", 50)*total {
+		b.open(now)
+		utils.Logger.WithField("failures", failures).WithField("attempts", total).Warn("Global circuit breaker opened, failing fast")
+	}
+}
+
+// endProbe releases the half-open probe slot if the probe finished without recording an outcome.
+func (b *circuitBreaker) endProbe() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// open trips the breaker. The caller must hold b.mu.
+func (b *circuitBreaker) open(now time.Time) {
+	b.openedAt = now
+	b.attempts, b.failures = nil, nil
+	b.setState(breakerOpen)
+}
+
+// setState updates the state and its gauge. The caller must hold b.mu.
+func (b *circuitBreaker) setState(state int) {
+	b.state = state
+	CircuitBreakerState.Set(float64(state))
+}
+
+// pruneBefore drops the leading times older than cutoff.
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
@@ -0,0 +1,240 @@
+package nodemanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/luishsr/eth-proxy/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheKey returns the map key for a JSON-RPC call along with its canonical "method:params" form.
+// With CACHE_HASH_KEYS=true the map key is the SHA-256 of the canonical form, which keeps keys
+// fixed-size for calls with large params; plain keys are used by default to ease debugging.
+func cacheKey(method string, params []interface{}) (key string, canonical string) {
+	paramBytes, err := json.Marshal(params)
+	if err != nil {
+		paramBytes = []byte(fmt.Sprint(params))
+	}
+	canonical = method + ":" + string(paramBytes)
+	return cacheMapKey(canonical), canonical
+}
+
+// cacheMapKey returns the map key for a canonical "method:params" key.
+func cacheMapKey(canonical string) string {
+	if !utils.GetEnvBool("CACHE_HASH_KEYS", false) {
+		return canonical
+	}
+
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:])
+}
+
+// getCached looks up a cached result for the call. A hashed key whose stored canonical form
+// differs from the requested one is treated as a miss rather than served.
+func (m *ClientManager) getCached(method string, params []interface{}) (CacheItem, bool) {
+	key, canonical := cacheKey(method, params)
+
+	m.mu.Lock()
+	item, found := m.Cache[key]
+	m.mu.Unlock()
+
+	if found && item.Key != canonical {
+		utils.Logger.WithField("key", key).Warn("Cache key collision detected, ignoring cached item")
+		return CacheItem{}, false
+	}
+
+	return item, found
+}
+
+// setCached stores a result for the call fetched at fetchedAt from node ("" if unknown) that stays
+// fresh for ttl, keeping the canonical key for collision checks. Concurrent refreshes of the same entry can finish out of order, so by default
+// a result older than the cached one is dropped; CACHE_WRITE_POLICY=last_write restores plain
+// last-writer-wins.
+func (m *ClientManager) setCached(method string, params []interface{}, balance string, raw json.RawMessage, fetchedAt time.Time, ttl time.Duration, node string) {
+	key, canonical := cacheKey(method, params)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, found := m.Cache[key]; found && existing.Key == canonical && existing.Timestamp.After(fetchedAt) &&
+		utils.GetEnv("CACHE_WRITE_POLICY") != "last_write" {
+		return
+	}
+
+	m.Cache[key] = CacheItem{
+		Balance:   balance,
+		Raw:       raw,
+		Timestamp: fetchedAt,
+		Key:       canonical,
+		TTL:       ttl,
+		Node:      node,
+	}
+}
+
+// balanceTTL returns how long a balance for address read at block stays fresh: like other
+// historical results (see blockCacheTTL) once a reorg can no longer replace block, else the
+// address's balance TTL.
+func (m *ClientManager) balanceTTL(ctx context.Context, address string, block string) time.Duration {
+	if isHistoricalBlock(block) && !m.recentBlock(ctx, block) {
+		return historicalCacheTTL()
+	}
+	return balanceCacheTTL(address)
+}
+
+// freshFor returns how long item stays fresh when its call's TTL is now ttl: the shorter of ttl
+// and the TTL it was stored with, so a result cached near the head keeps its short TTL once its
+// block is buried.
+func freshFor(item CacheItem, ttl time.Duration) time.Duration {
+	if item.TTL > 0 && item.TTL < ttl {
+		return item.TTL
+	}
+	return ttl
+}
+
+// balanceCacheTTL returns how long a balance for address stays fresh: its entry in
+// CACHE_TTL_OVERRIDES ("0xhot=5,0xcold=3600", in seconds) if any, else CACHE_EXPIRATION_SECONDS
+// (60 by default). Overrides let volatile hot wallets refresh quickly while cold ones stay cached.
+func balanceCacheTTL(address string) time.Duration {
+	for _, entry := range strings.Split(utils.GetEnv("CACHE_TTL_OVERRIDES"), ",") {
+		overrideAddress, seconds, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || !strings.EqualFold(strings.TrimSpace(overrideAddress), address) {
+			continue
+		}
+
+		ttl, err := strconv.Atoi(strings.TrimSpace(seconds))
+		if err != nil || ttl <= 0 {
+			utils.Logger.WithField("entry", entry).Warn("Ignoring invalid CACHE_TTL_OVERRIDES entry")
+			break
+		}
+		return time.Duration(ttl) * time.Second
+	}
+
+	return time.Duration(utils.GetEnvInt("CACHE_EXPIRATION_SECONDS", 60)) * time.Second
+}
+
+// cachedCall returns the result of a JSON-RPC call, normalized by parse, from the cache while it
+// is younger than ttl and from the nodes otherwise. A zero ttl bypasses the cache.
+func (m *ClientManager) cachedCall(ctx context.Context, method string, params []interface{}, ttl time.Duration, parse func(json.RawMessage) (string, error)) (string, error) {
+	if ttl > 0 {
+		if item, found := m.getCached(method, params); found && time.Since(item.Timestamp) <= freshFor(item, ttl) {
+			return item.Balance, nil
+		}
+	}
+
+	result, err := m.Call(ctx, method, params)
+	if err != nil {
+		return "", err
+	}
+	fetchedAt := time.Now()
+	if isNullResult(result) {
+		return "", ErrNullResult
+	}
+	value, err := parse(result)
+	if err != nil {
+		return "", err
+	}
+
+	if ttl > 0 {
+		m.setCached(method, params, value, result, fetchedAt, ttl, "")
+	}
+	return value, nil
+}
+
+// CachedBalance returns the cached latest balance of address, even if expired, without
+// contacting any node.
+func (m *ClientManager) CachedBalance(address string) (string, bool) {
+	item, found := m.getCached("eth_getBalance", []interface{}{address, "latest"})
+	return item.Balance, found
+}
+
+// balanceParams extracts the address and block of a cached eth_getBalance result.
+func balanceParams(item CacheItem) (address string, block string, ok bool) {
+	params := strings.TrimPrefix(item.Key, "eth_getBalance:")
+	if params == item.Key {
+		return "", "", false
+	}
+
+	var decoded []string
+	if err := json.Unmarshal([]byte(params), &decoded); err != nil || len(decoded) != 2 {
+		return "", "", false
+	}
+	return decoded[0], decoded[1], true
+}
+
+// CacheEntryAge describes a cached balance and how long ago it was fetched.
+type CacheEntryAge struct {
+	Address    string  `json:"address"`
+	Block      string  `json:"block"`
+	AgeSeconds float64 `json:"ageSeconds"`
+}
+
+// CacheRefresh is the outcome of re-fetching a cached balance.
+type CacheRefresh struct {
+	Address string `json:"address"`
+	Block   string `json:"block"`
+	Balance string `json:"balance,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// OldestCacheEntries returns the n least recently fetched cached balances, oldest first.
+func (m *ClientManager) OldestCacheEntries(n int) []CacheEntryAge {
+	m.mu.Lock()
+	items := make([]CacheItem, 0, len(m.Cache))
+	for _, item := range m.Cache {
+		items = append(items, item)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Timestamp.Before(items[j].Timestamp) })
+
+	entries := make([]CacheEntryAge, 0, n)
+	for _, item := range items {
+		if len(entries) == n {
+			break
+		}
+		address, block, ok := balanceParams(item)
+		if !ok {
+			continue
+		}
+		entries = append(entries, CacheEntryAge{Address: address, Block: block, AgeSeconds: time.Since(item.Timestamp).Seconds()})
+	}
+	return entries
+}
+
+// RefreshOldestCacheEntries re-fetches the n least recently fetched cached balances from the nodes,
+// bypassing the cache, concurrently bounded by BATCH_CONCURRENCY. Entries whose refresh fails keep
+// their cached value.
+func (m *ClientManager) RefreshOldestCacheEntries(ctx context.Context, n int) []CacheRefresh {
+	entries := m.OldestCacheEntries(n)
+	results := make([]CacheRefresh, len(entries))
+	semaphore := make(chan struct{}, utils.GetEnvInt("BATCH_CONCURRENCY", 8))
+	var wg sync.WaitGroup
+
+	for i, entry := range entries {
+		wg.Add(1)
+		go func(i int, entry CacheEntryAge) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			results[i] = CacheRefresh{Address: entry.Address, Block: entry.Block}
+			result, err := m.fetchBalance(ctx, entry.Address, entry.Block)
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			m.setCached("eth_getBalance", []interface{}{entry.Address, entry.Block}, result.Balance, result.Raw, result.fetchedAt, m.balanceTTL(ctx, entry.Address, entry.Block), result.Node)
+			results[i].Balance = result.Balance
+		}(i, entry)
+	}
+
+	wg.Wait()
+	return results
+}
@@ -3,43 +3,115 @@ package nodemanager
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/luishsr/eth-proxy/utils"
 	"github.com/sirupsen/logrus"
 	"io"
+	"math/big"
 	"net/http"
-	"os"
+	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+// maxLoggedBodyBytes bounds how much of an undecodable upstream body is logged.
+const maxLoggedBodyBytes = 256
+
+// defaultMaxUpstreamResponseBytes caps upstream response bodies when MAX_UPSTREAM_RESPONSE_BYTES is unset.
+const defaultMaxUpstreamResponseBytes = 1 << 20
+
 type NodeConfig struct {
-	Name string
-	URL  string
+	Name        string
+	URL         string
+	HealthCheck *HealthCheckPayload // Optional custom health-check probe; defaults to web3_clientVersion.
+	Method      string              // HTTP method used for JSON-RPC calls: POST (default) or GET.
+	Region      string              // Optional region; clients in the same region prefer the node.
+	TLS         *tls.Config         // Optional TLS settings for private nodes (see NewNodeTLSConfig).
+	Maintenance []MaintenanceWindow // Optional daily windows during which the node is not selected.
+
+	BlockTagAliases map[string]string // Optional provider-specific names for standard block tags.
+	RateLimit       float64           // Optional client-side limit in requests per second; 0 means unlimited.
+	Archive         bool              // Whether the node keeps historical state; historical queries go to archive nodes.
 }
 
 type EthereumNode struct {
-	URL        string
-	Name       string
-	Healthy    bool
-	LastUsed   time.Time
-	ErrorCount int
+	URL         string
+	Name        string
+	Healthy     bool
+	LastUsed    time.Time
+	ErrorCount  int
+	HealthCheck HealthCheckPayload  // Probe sent by CheckNodeHealth; empty means defaultHealthCheck.
+	Method      string              // HTTP method used for JSON-RPC calls; empty means POST.
+	Draining    bool                // Set while the node is being removed; draining nodes get no new requests.
+	Region      string              // Region the node runs in; empty if unknown.
+	Maintenance []MaintenanceWindow // Daily windows during which the node is not selected.
+
+	BlockTagAliases map[string]string // Provider-specific names standard block tags are rewritten to.
+	Archive         bool              // Whether the node keeps historical state (see NodeConfig.Archive).
+
+	FunctionalHealthy *bool         // Outcome of the latest functional (eth_getBalance) health check; nil if none ran.
+	LastLatency       time.Duration // Round trip of the latest successful balance fetch, guarded by ClientManager.mu.
+	AvgLatency        time.Duration // Exponentially weighted moving average of LastLatency, guarded by ClientManager.mu.
+
+	limiter         *tokenBucket      // Client-side rate limit, guarded by ClientManager.mu; nil if unlimited.
+	healthCheck     *healthCheckRun   // Health check in flight, guarded by ClientManager.mu; nil if none.
+	requestFailures []time.Time       // Recent consecutive request failures, guarded by ClientManager.mu.
+	inFlight        int               // Requests currently running against the node, guarded by ClientManager.mu.
+	drained         chan struct{}     // Closed once a draining node has no requests in flight.
+	removed         bool              // Set once the node has been removed from the manager.
+	responseHeaders map[string]string // Latest captured upstream response headers, guarded by ClientManager.mu.
+	client          *http.Client      // Dedicated client for nodes with their own TLS settings; nil uses the manager's.
+	blockHeight     uint64            // Latest block height seen by stuck-node checks, guarded by ClientManager.mu.
+	stalledChecks   int               // Consecutive stuck-node checks without a height change, guarded by ClientManager.mu.
+	stuck           bool              // Quarantined as stuck until its height moves, guarded by ClientManager.mu.
 }
 
 type CacheItem struct {
 	Balance   string
+	Raw       json.RawMessage // Upstream JSON-RPC response body the balance was read from.
 	Timestamp time.Time
+	Key       string        // Canonical "method:params" key, used to verify hashed-key lookups.
+	TTL       time.Duration // How long the item stays fresh, as of when it was stored; 0 if unknown.
+	Node      string        // Name of the node the result was read from, if known.
+}
+
+// BalanceResult is the outcome of a balance lookup.
+type BalanceResult struct {
+	Balance string
+	Raw     json.RawMessage // Upstream JSON-RPC response body, verbatim.
+	Cached  bool            // Whether the balance was served from the cache rather than a node.
+	Stale   bool            // Whether the cached balance had expired and a refresh failed.
+	Node    string          // Name of the node the balance was read from, when fetched or cached.
+
+	fetchedAt time.Time // When the balance was read from a node.
 }
 
 type ClientManager struct {
-	Nodes        []*EthereumNode
-	mu           sync.Mutex
-	index        int
-	lastNodeName string
-	Cache        map[string]CacheItem
-	httpClient   *http.Client
+	Nodes          []*EthereumNode
+	mu             sync.Mutex
+	index          int
+	lastNodeName   string
+	Cache          map[string]CacheItem
+	httpClient     *http.Client
+	selections     []string // Ring buffer of recently selected node names.
+	selectionPos   int
+	selectionCount int
+	roundCounts    map[string]int // Selections per node in the current fairness round; see leastSelected.
+	roundStarted   time.Time
+	priceCache     sharedValue     // Shared ETH/USD price.
+	gasPriceCache  sharedValue     // Shared gas price.
+	headCache      sharedValue     // Shared head block number; see headBlock.
+	blockEntries   map[string]bool // Cache keys of numbered blocks; see trackBlockEntry.
+	blockOrder     []string        // blockEntries keys, oldest first.
+	breaker        circuitBreaker  // Global breaker across all nodes.
+
+	lastUpstreamSuccess time.Time // Last successful upstream balance fetch.
+	upstreamStale       bool      // Whether UpstreamStale is currently raised.
 }
 
 type jsonRPCPayload struct {
@@ -50,7 +122,7 @@ type jsonRPCPayload struct {
 }
 
 type jsonRPCResponse struct {
-	Result string `json:"result"`
+	Result json.RawMessage `json:"result"`
 	Error  *struct {
 		Code    int    `json:"code"`
 		Message string `json:"message"`
@@ -59,103 +131,138 @@ type jsonRPCResponse struct {
 }
 
 // NewClientManager initializes a new ClientManager with the given node configurations and HTTP client.
+// Nodes are selected in configuration order, starting at ROUND_ROBIN_SEED modulo the node count.
 func NewClientManager(nodes []NodeConfig, httpClient *http.Client) *ClientManager {
 	manager := &ClientManager{
-		Cache:      make(map[string]CacheItem),
-		httpClient: httpClient,
+		Cache:               make(map[string]CacheItem),
+		httpClient:          httpClient,
+		selections:          make([]string, utils.GetEnvInt("SELECTION_WINDOW", 1000)),
+		lastUpstreamSuccess: time.Now(),
 	}
 
 	for _, n := range nodes {
-		manager.Nodes = append(manager.Nodes, &EthereumNode{Name: n.Name, URL: n.URL, Healthy: true})
+		node := &EthereumNode{Name: n.Name, URL: n.URL, Healthy: true, Method: n.Method, Region: n.Region, Maintenance: n.Maintenance, BlockTagAliases: n.BlockTagAliases, Archive: n.Archive, limiter: newTokenBucket(n.RateLimit)}
+		if n.HealthCheck != nil {
+			node.HealthCheck = *n.HealthCheck
+		}
+		if n.TLS != nil {
+			node.client = nodeClient(httpClient, n.Name, n.TLS)
+		}
+		manager.Nodes = append(manager.Nodes, node)
 	}
 
+	manager.ResetRoundRobin(utils.GetEnvInt("ROUND_ROBIN_SEED", 0))
+	manager.updateNodeGauges()
 	return manager
 }
 
+// ResetRoundRobin restarts round-robin selection at the node at position start (modulo the node
+// count), e.g. after reconfiguration or to replay a known selection sequence.
+func (m *ClientManager) ResetRoundRobin(start int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.index = 0
+	if len(m.Nodes) > 0 {
+		m.index = (start%len(m.Nodes) + len(m.Nodes)) % len(m.Nodes)
+	}
+}
+
 // NextNode selects the next healthy node using a round-robin algorithm.
 func (m *ClientManager) NextNode() *EthereumNode {
+	return m.NextNodeInRegion("")
+}
+
+// NextNodeInRegion selects the next healthy node in region, round-robin, falling back to the next
+// healthy node in any region when none is available there. An empty region has no preference.
+// Nodes within a maintenance window are skipped, and nodes whose client-side rate limit would make
+// the request wait are only picked when no other node is available. Archive nodes are only picked
+// when no other node is available either.
+func (m *ClientManager) NextNodeInRegion(region string) *EthereumNode {
+	return m.nextNode(region, false, nil)
+}
+
+// nextNode is NextNodeInRegion, restricted to archive nodes when archive is set. Nodes in tried,
+// those a failing request already attempted, are only picked again when no other node is available,
+// so retries move on to the next preference (e.g. another region) rather than the node that failed.
+func (m *ClientManager) nextNode(region string, archive bool, tried map[*EthereumNode]bool) *EthereumNode {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	startIdx := m.index
-	for attempt := 0; attempt < len(m.Nodes); attempt++ {
-		node := m.Nodes[m.index]
-		m.index = (m.index + 1) % len(m.Nodes)
+	pools := []func(*EthereumNode) bool{
+		func(node *EthereumNode) bool { return !node.Archive },
+		func(node *EthereumNode) bool { return true },
+	}
+	if archive {
+		pools = []func(*EthereumNode) bool{func(node *EthereumNode) bool { return node.Archive }}
+	}
 
-		if node.Healthy {
-			m.lastNodeName = node.Name
-			return node
+	now := time.Now()
+	untried := func(node *EthereumNode) bool { return !tried[node] }
+	for _, allowed := range []func(*EthereumNode) bool{untried, func(*EthereumNode) bool { return true }} {
+		for _, inPool := range pools {
+			candidate := func(node *EthereumNode) bool { return allowed(node) && inPool(node) && node.selectable(now) }
+			if node := m.selectNode(region, func(node *EthereumNode) bool { return candidate(node) && node.limiter.available(now) }); node != nil {
+				return node
+			}
+			if node := m.selectNode(region, candidate); node != nil {
+				return node
+			}
 		}
-
-		if m.index == startIdx {
-			utils.Logger.Warn("All Ethereum nodes have been checked and none are healthy")
-			break
+		if len(tried) == 0 {
+			break // Nothing was excluded, so a second pass would find nothing either.
 		}
-
 	}
 
+	utils.Logger.Warn("All Ethereum nodes have been checked and none are healthy")
 	return nil // No healthy nodes found
 }
 
-// CheckNodeHealth performs a health check on the specified node.
-func (m *ClientManager) CheckNodeHealth(node *EthereumNode) {
-	payload := jsonRPCPayload{
-		JSONRPC: "2.0",
-		Method:  "web3_clientVersion",
-		Params:  []interface{}{},
-		ID:      1,
+// selectNode picks the next eligible node round-robin, preferring nodes in region, and records the
+// selection. Outside region, LB_STRATEGY=latency picks the fastest node instead (see fastestNode),
+// and with ROUND_ROBIN_MAX_AGE_SECONDS set the least-selected one (see leastSelected). Callers must
+// hold m.mu.
+func (m *ClientManager) selectNode(region string, eligible func(*EthereumNode) bool) *EthereumNode {
+	if region != "" {
+		for offset := 0; offset < len(m.Nodes); offset++ {
+			i := (m.index + offset) % len(m.Nodes)
+			node := m.Nodes[i]
+			if eligible(node) && strings.EqualFold(node.Region, region) {
+				m.index = (i + 1) % len(m.Nodes)
+				m.lastNodeName = node.Name
+				m.recordSelection(node.Name)
+				return node
+			}
+		}
 	}
 
-	payloadBytes, err := json.Marshal(payload)
-
-	if err != nil {
-		utils.Logger.WithError(err).Error("Failed to marshal JSON RPC payload")
-		return
+	var pick func() (int, *EthereumNode)
+	if lbStrategy() == StrategyLatency {
+		pick = func() (int, *EthereumNode) { return m.fastestNode(eligible) }
+	} else if maxAge := fairRoundMaxAge(); maxAge > 0 {
+		pick = func() (int, *EthereumNode) { return m.leastSelected(eligible, maxAge, time.Now()) }
 	}
-
-	req, err := http.NewRequest("POST", node.URL, bytes.NewReader(payloadBytes))
-	if err != nil {
-		utils.Logger.WithError(err).Error("Failed to create new HTTP request")
-		return
+	if pick != nil {
+		i, node := pick()
+		if node != nil {
+			m.index = (i + 1) % len(m.Nodes)
+			m.lastNodeName = node.Name
+			m.recordSelection(node.Name)
+		}
+		return node
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := m.httpClient.Do(req)
-
-	utils.Logger.Info("Health-checking Node: " + node.Name)
+	for attempt := 0; attempt < len(m.Nodes); attempt++ {
+		node := m.Nodes[m.index]
+		m.index = (m.index + 1) % len(m.Nodes)
 
-	if err != nil || resp.StatusCode != http.StatusOK {
-		node.Healthy = false
-		node.ErrorCount++
-		if node.ErrorCount >= 3 {
-			go m.cooldownNode(node, 1*time.Minute)
+		if eligible(node) {
+			m.lastNodeName = node.Name
+			m.recordSelection(node.Name)
+			return node
 		}
-
-		utils.Logger.Info("*** Node " + node.Name + " is not running!")
-
-		utils.Logger.WithFields(logrus.Fields{
-			"node":        node.Name,
-			"status_code": resp.StatusCode,
-			"error":       err,
-		}).Println("Ethereum Node health check failed")
-	} else {
-		utils.Logger.Info("Node " + node.Name + " is up and running!")
-		node.Healthy = true
-		node.ErrorCount = 0
 	}
-
-	err = resp.Body.Close()
-	if err != nil {
-		return
-	}
-}
-
-// cooldownNode temporarily marks a node as unhealthy before rechecking its health.
-func (m *ClientManager) cooldownNode(node *EthereumNode, duration time.Duration) {
-	time.Sleep(duration) // Wait for the cooldown period
-	node.Healthy = true  // Assume the node might be healthy now
-	node.ErrorCount = 0  // Reset error count
-	utils.Logger.WithField("node", node.Name).Warn("Ethereum Node cooldown period ended, marking as healthy")
+	return nil
 }
 
 // GetNodeName returns the name of the last used node.
@@ -165,28 +272,13 @@ func (m *ClientManager) GetNodeName() string {
 	return m.lastNodeName
 }
 
-// StartHealthChecks begins periodic health checks for each node.
-func (m *ClientManager) StartHealthChecks(interval time.Duration) {
-	utils.Logger.Info("Ethereum Nodes periodic health check started")
-	for _, node := range m.Nodes {
-		go func(n *EthereumNode) {
-			ticker := time.NewTicker(interval)
-			defer ticker.Stop()
-
-			for range ticker.C {
-				m.CheckNodeHealth(n)
-			}
-		}(node)
-	}
-}
-
 // IsReady checks if at least one node is healthy and ready.
 func (m *ClientManager) IsReady() bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	for _, node := range m.Nodes {
-		if node.Healthy {
+		if node.Healthy && !node.Draining {
 			return true
 			// At least one node is healthy
 		}
@@ -197,102 +289,287 @@ func (m *ClientManager) IsReady() bool {
 
 // GetBalance fetches the balance for a given Ethereum address, using cache when possible, and retries with a different node if necessary.
 func (m *ClientManager) GetBalance(address string) (string, error) {
-	// Read timeout value from environment variable, with a default.
-	timeoutSecs, err := strconv.Atoi(os.Getenv("NODE_REQUEST_TIMEOUT_SECONDS"))
-	if err != nil || timeoutSecs <= 0 {
-		timeoutSecs = 5 // Default timeout of 5 seconds if not specified or invalid.
+	result, err := m.GetBalanceResult(context.Background(), address)
+	if err != nil {
+		return "", err
 	}
+	return result.Balance, nil
+}
 
-	// Read the max retry count from environment, with a default.
-	maxRetries, err := strconv.Atoi(os.Getenv("MAX_RETRIES"))
-	if err != nil || maxRetries < 0 {
-		maxRetries = 3 // Default to 3 retries if not specified or invalid.
+// GetBalanceAtBlock is GetBalance at the given block tag or number (see GetBalanceAt).
+func (m *ClientManager) GetBalanceAtBlock(address string, blockTag string) (string, error) {
+	result, err := m.GetBalanceAt(context.Background(), address, blockTag)
+	if err != nil {
+		return "", err
 	}
+	return result.Balance, nil
+}
 
-	m.mu.Lock()
-	cachedItem, found := m.Cache[address]
-	m.mu.Unlock()
+// GetBalanceResult is GetBalance bound to ctx, also returning the upstream JSON-RPC response.
+func (m *ClientManager) GetBalanceResult(ctx context.Context, address string) (*BalanceResult, error) {
+	return m.GetBalanceAt(ctx, address, "latest")
+}
 
-	cacheExpirationSecs, err := strconv.Atoi(os.Getenv("CACHE_EXPIRATION_SECONDS"))
-	if err != nil || cacheExpirationSecs <= 0 {
-		cacheExpirationSecs = 60 // Default to 60 seconds if not specified or invalid
+// GetBalanceAt is GetBalanceResult at the given block tag or number. Pending balances change with
+// every new transaction in the mempool, so they always bypass the cache, while balances at a
+// block number never change and are cached long-term.
+// When the cached balance has expired and refreshing it fails, ON_REFRESH_FAILURE decides
+// whether the expired balance is served as stale ("serve_stale") or the error is returned ("error", the default).
+func (m *ClientManager) GetBalanceAt(ctx context.Context, address string, block string) (*BalanceResult, error) {
+	if err := validateBlock(block); err != nil {
+		return nil, err
 	}
+	if block == "pending" {
+		return m.fetchBalance(ctx, address, block)
+	}
+
+	params := []interface{}{address, block}
+	lookupStart := time.Now()
+	cachedItem, found := m.getCached("eth_getBalance", params)
+	timingFrom(ctx).since(PhaseCache, lookupStart)
 
 	// Check if the address is in the cache and if the cache item is still valid
 	if found {
 		// Calculate the age of the cache item
 		cacheAge := time.Since(cachedItem.Timestamp)
 
-		if cacheAge.Seconds() <= float64(cacheExpirationSecs) {
+		if cacheAge <= freshFor(cachedItem, m.balanceTTL(ctx, address, block)) {
 			// Cache item is still valid, return the cached balance
-			return cachedItem.Balance, nil
+			m.checkUpstreamStale()
+			return &BalanceResult{Balance: cachedItem.Balance, Raw: cachedItem.Raw, Cached: true, Node: cachedItem.Node}, nil
 		}
 	}
 
+	result, err := m.fetchBalance(ctx, address, block)
+	if err != nil {
+		if found && utils.GetEnv("ON_REFRESH_FAILURE") == "serve_stale" {
+			utils.Logger.WithError(err).WithField("address", address).Warn("Balance refresh failed, serving stale cached balance")
+			m.checkUpstreamStale()
+			return &BalanceResult{Balance: cachedItem.Balance, Raw: cachedItem.Raw, Cached: true, Stale: true, Node: cachedItem.Node}, nil
+		}
+		return nil, err
+	}
+
+	m.setCached("eth_getBalance", params, result.Balance, result.Raw, result.fetchedAt, m.balanceTTL(ctx, address, block), result.Node)
+	return result, nil
+}
+
+// fetchBalance fetches the balance from the next healthy node, retrying with a different node if necessary.
+func (m *ClientManager) fetchBalance(ctx context.Context, address string, block string) (*BalanceResult, error) {
+	ctx = forBlock(ctx, block)
+	var result *BalanceResult
+	err := m.withFailover(ctx, "eth_getBalance", "balance", func(ctx context.Context, node *EthereumNode) error {
+		balance, raw, err := m.fetchBalanceFromNode(ctx, node, address, block)
+		if err != nil {
+			return err
+		}
+		result = &BalanceResult{Balance: balance, Raw: raw, Node: node.Name, fetchedAt: time.Now()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.recordUpstreamSuccess()
+
+	return result, nil
+}
+
+// fetchBalanceFromNode retrieves the balance for a given Ethereum address at block from a specific node,
+// along with the raw JSON-RPC response body it was decoded from.
+func (m *ClientManager) fetchBalanceFromNode(ctx context.Context, node *EthereumNode, address string, block string) (string, json.RawMessage, error) {
+	start := time.Now()
+	result, body, err := m.callNode(ctx, node, "eth_getBalance", []interface{}{address, block})
+	if err != nil {
+		return "", nil, err
+	}
+	if isNullResult(result) {
+		return "", nil, ErrNullResult
+	}
+
+	balance, err := parseQuantity(result)
+	if err != nil {
+		return "", nil, err
+	}
+
+	m.recordLatency(node, time.Since(start))
+	return balance, body, nil
+}
+
+// Call sends a JSON-RPC request to the next healthy node, retrying with a different node if
+// necessary, and returns the call's raw result.
+func (m *ClientManager) Call(ctx context.Context, method string, params []interface{}) (json.RawMessage, error) {
+	var result json.RawMessage
+	err := m.withFailover(ctx, method, method, func(ctx context.Context, node *EthereumNode) error {
+		var err error
+		result, _, err = m.callNode(ctx, node, method, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// withFailover runs attempt against successive healthy nodes until it succeeds, fails with a
+// non-retriable JSON-RPC error, the method's retries (see maxRetriesFor) are exhausted or ctx is done.
+// Each attempt gets its own deadline (NODE_REQUEST_TIMEOUT_SECONDS unless overridden with
+// WithNodeTimeout), each retry prefers a node not yet tried, and nodes that keep failing are marked
+// unhealthy (see recordRequestFailure).
+func (m *ClientManager) withFailover(ctx context.Context, method string, description string, attempt func(ctx context.Context, node *EthereumNode) error) error {
+	timeout := nodeTimeout(ctx)
+	maxRetries := maxRetriesFor(method)
+
+	// Resolved before consulting the breaker, since it may itself look up the head block.
+	archive, err := m.requiresArchive(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Shed load while the providers as a whole are failing.
+	allowed, probe := m.breaker.allow()
+	if !allowed {
+		return &CircuitOpenError{RetryAfter: m.breaker.retryAfter()}
+	}
+	if probe {
+		defer m.breaker.endProbe()
+	}
+
+	timing := timingFrom(ctx)
 	var lastErr error
+	var attempts []AttemptError
+	tried := make(map[*EthereumNode]bool)
 	for i := 0; i <= maxRetries; i++ {
-		node := m.NextNode()
+		// Don't start an attempt the caller's overall deadline leaves no time to finish.
+		if ctx.Err() != nil {
+			return callerGaveUp(ctx, description)
+		}
+
+		selectStart := time.Now()
+		node := m.nextNode(clientRegion(ctx), archive, tried)
 
 		// No Ethereum nodes available
 		if node == nil {
-			return "",
-				fmt.Errorf("no healthy Ethereum Nodes available to fetch the balance")
+			if archive {
+				return ErrNoArchiveNode
+			}
+			return fmt.Errorf("no healthy Ethereum Nodes available to fetch the %s", description)
+		}
+
+		// Stay under the node's client-side rate limit before dialing it.
+		if err := m.throttle(ctx, node); err != nil {
+			return callerGaveUp(ctx, description)
 		}
+		timing.since(PhaseSelect, selectStart)
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSecs)*time.Second)
+		m.acquireNode(node)
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		upstreamStart := time.Now()
+		err := attempt(attemptCtx, node)
+		timing.since(PhaseUpstream, upstreamStart)
+		cancel()
+		m.releaseNode(node)
 
-		balance, err := m.fetchBalanceFromNode(ctx, node, address)
 		if err == nil {
-			cancel()
-			return balance, nil
-		} else {
-			m.mu.Lock()
-			m.Cache[address] = CacheItem{
-				Balance:   balance,
-				Timestamp: time.Now(),
-			}
-			m.mu.Unlock()
+			m.breaker.record(false)
+			m.recordRequestSuccess(node)
+			return nil
 		}
 
 		lastErr = err
-		// Mark the node as unhealthy if there was an error fetching the balance.
-		node.Healthy = false
+		tried[node] = true
+		attempts = append(attempts, AttemptError{Node: node.Name, Error: err.Error()})
 
-		cancel()
+		// The caller gave up (e.g. its own deadline passed); that says nothing about the node's health.
+		if ctx.Err() != nil {
+			return callerGaveUp(ctx, description)
+		}
+
+		// A JSON-RPC error outside the retriable set (e.g. invalid params) would fail on every node.
+		var rpcErr *RPCError
+		if errors.As(err, &rpcErr) && !isRetriableRPCCode(rpcErr.Code) {
+			m.breaker.record(false) // The node answered; the request itself was bad.
+			return err
+		}
+
+		m.breaker.record(true)
+		m.recordRequestFailure(node)
 	}
 
 	// Return the last error after exhausting retries.
-	return "", fmt.Errorf("failed to fetch balance after %d retries, last error: %w", maxRetries, lastErr)
+	return &RetriesExhaustedError{Description: description, Retries: maxRetries, Attempts: attempts, Last: lastErr}
+}
+
+// callerGaveUp returns the error for a lookup abandoned because ctx is done, counting expired deadlines.
+func callerGaveUp(ctx context.Context, description string) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		DeadlineExceeded.Inc()
+	}
+	return fmt.Errorf("failed to fetch %s: %w", description, ctx.Err())
+}
+
+// recordRequestFailure notes a failed request against node and marks it unhealthy once it has failed
+// REQUEST_FAILURE_THRESHOLD consecutive requests (3 by default) within REQUEST_FAILURE_WINDOW_SECONDS
+// (60 by default). With DEMOTE_ON_REQUEST_FAILURE=false, request failures never change node health,
+// leaving it to the health checker.
+func (m *ClientManager) recordRequestFailure(node *EthereumNode) {
+	if !utils.GetEnvBool("DEMOTE_ON_REQUEST_FAILURE", true) {
+		return
+	}
+
+	threshold := utils.GetEnvInt("REQUEST_FAILURE_THRESHOLD", 3)
+	window := time.Duration(utils.GetEnvInt("REQUEST_FAILURE_WINDOW_SECONDS", 60)) * time.Second
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	failures := append(node.requestFailures, now)
+	for len(failures) > 0 && now.Sub(failures[0]) > window {
+		failures = failures[1:]
+	}
+	if len(failures) > threshold {
+		failures = failures[len(failures)-threshold:]
+	}
+	node.requestFailures = failures
+
+	if len(failures) >= threshold {
+		node.Healthy = false
+		node.requestFailures = nil
+		m.updateNodeGauges()
+		utils.Logger.WithField("node", node.Name).Warn("Ethereum Node failed too many requests, marking as unhealthy")
+	}
+}
+
+// recordRequestSuccess clears node's run of failed requests.
+func (m *ClientManager) recordRequestSuccess(node *EthereumNode) {
+	m.mu.Lock()
+	node.requestFailures = nil
+	m.mu.Unlock()
 }
 
-// fetchBalanceFromNode retrieves the balance for a given Ethereum address from a specific node.
-func (m *ClientManager) fetchBalanceFromNode(ctx context.Context, node *EthereumNode, address string) (string, error) {
+// callNode sends a single JSON-RPC request to a specific node, returning the call's result along
+// with the raw response body it was decoded from.
+func (m *ClientManager) callNode(ctx context.Context, node *EthereumNode, method string, params []interface{}) (json.RawMessage, []byte, error) {
 	payload := jsonRPCPayload{
 		JSONRPC: "2.0",
-		Method:  "eth_getBalance",
-		Params:  []interface{}{address, "latest"},
+		Method:  method,
+		Params:  params,
 		ID:      1,
 	}
 
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		utils.Logger.WithError(err).Error("Failed to marshal JSON RPC payload")
-		return "", err
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", node.URL, bytes.NewReader(payloadBytes))
+	req, err := newRPCRequest(ctx, node, payload)
 	if err != nil {
-		utils.Logger.WithError(err).Error("Failed to create new HTTP request")
-		return "", err
+		return nil, nil, err
 	}
 
-	// Send the request using httpClient...
-	resp, err := m.httpClient.Do(req)
+	// Send the request using the node's HTTP client...
+	resp, err := m.clientFor(node).Do(req)
 	if err != nil {
 		utils.Logger.WithError(err).WithFields(logrus.Fields{
 			"node_url": node.URL,
 		}).Error("Failed to execute HTTP request")
-		return "", err
+		return nil, nil, err
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
@@ -301,6 +578,9 @@ func (m *ClientManager) fetchBalanceFromNode(ctx context.Context, node *Ethereum
 		}
 	}(resp.Body)
 
+	// Record provider rate-limit headers, including on 429s.
+	m.captureResponseHeaders(node, resp.Header)
+
 	// Handle response...
 	if resp.StatusCode != http.StatusOK {
 		errMsg := fmt.Sprintf("unexpected status code: %d", resp.StatusCode)
@@ -308,17 +588,183 @@ func (m *ClientManager) fetchBalanceFromNode(ctx context.Context, node *Ethereum
 			"status_code": resp.StatusCode,
 			"node_url":    node.URL,
 		}).Error(errMsg)
-		return "", fmt.Errorf(errMsg)
+		return nil, nil, fmt.Errorf(errMsg)
+	}
+
+	// Read at most one byte past the limit so an oversized body is detected without buffering it.
+	maxBytes := utils.GetEnvInt("MAX_UPSTREAM_RESPONSE_BYTES", defaultMaxUpstreamResponseBytes)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(body) > maxBytes {
+		utils.Logger.WithFields(logrus.Fields{
+			"node_url":  node.URL,
+			"max_bytes": maxBytes,
+		}).Error("Upstream response exceeds size limit")
+		return nil, nil, ErrResponseTooLarge
+	}
+
+	if sampleUpstreamLog() {
+		logSampledCall(node, payload, body)
 	}
 
 	var result jsonRPCResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	if err := json.Unmarshal(body, &result); err != nil {
+		// Typically an HTML error page served with a 200 status; worth retrying on another node.
+		UpstreamDecodeErrors.WithLabelValues(node.Name).Inc()
+		utils.Logger.WithFields(logrus.Fields{
+			"node": node.Name,
+			"body": truncate(string(body), maxLoggedBodyBytes),
+		}).Debug("Failed to decode upstream response")
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidUpstreamResponse, err)
 	}
 
 	if result.Error != nil {
-		return "", fmt.Errorf("error response from node: %s", result.Error.Message)
+		return nil, nil, &RPCError{Code: result.Error.Code, Message: result.Error.Message}
+	}
+
+	return result.Result, body, nil
+}
+
+// newRPCRequest builds the HTTP request carrying a JSON-RPC payload to a node, forwarding
+// the caller's request ID so provider-side logs can be correlated. Block tags in the params are
+// rewritten to the node's aliases, if any.
+func newRPCRequest(ctx context.Context, node *EthereumNode, payload jsonRPCPayload) (*http.Request, error) {
+	payload.Params = node.aliasBlockTags(payload.Params)
+	if node.Method == http.MethodGet {
+		return newRPCGetRequest(ctx, node, payload)
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		utils.Logger.WithError(err).Error("Failed to marshal JSON RPC payload")
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", node.URL, bytes.NewReader(payloadBytes))
+	if err != nil {
+		utils.Logger.WithError(err).Error("Failed to create new HTTP request")
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	setRequestIDHeader(ctx, req)
+	return req, nil
+}
+
+// newRPCGetRequest builds a JSON-RPC GET request for nodes that require it, encoding the call
+// in the query string as jsonrpc, method, id and JSON-encoded params.
+func newRPCGetRequest(ctx context.Context, node *EthereumNode, payload jsonRPCPayload) (*http.Request, error) {
+	params, err := json.Marshal(payload.Params)
+	if err != nil {
+		utils.Logger.WithError(err).Error("Failed to marshal JSON RPC params")
+		return nil, err
 	}
 
-	return result.Result, nil
+	endpoint, err := url.Parse(node.URL)
+	if err != nil {
+		utils.Logger.WithError(err).Error("Failed to parse node URL")
+		return nil, err
+	}
+	query := endpoint.Query()
+	query.Set("jsonrpc", payload.JSONRPC)
+	query.Set("method", payload.Method)
+	query.Set("params", string(params))
+	query.Set("id", strconv.Itoa(payload.ID))
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		utils.Logger.WithError(err).Error("Failed to create new HTTP request")
+		return nil, err
+	}
+
+	setRequestIDHeader(ctx, req)
+	return req, nil
+}
+
+// setRequestIDHeader forwards the request's correlation ID, if any, to the upstream node.
+func setRequestIDHeader(ctx context.Context, req *http.Request) {
+	if id := utils.RequestIDFromContext(ctx); id != "" {
+		req.Header.Set(utils.RequestIDHeader(), id)
+	}
+}
+
+// parseQuantity normalizes a JSON-RPC quantity result to canonical 0x-prefixed lowercase hex
+// without leading zeros. Besides the standard hex string it tolerates the decimal strings and
+// bare JSON numbers returned by some non-standard providers and mocks.
+func parseQuantity(raw json.RawMessage) (string, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		// Not a JSON string; accept a bare integer number.
+		var number json.Number
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&number); err != nil {
+			return "", fmt.Errorf("%w: %s", ErrInvalidQuantity, truncate(string(raw), maxLoggedBodyBytes))
+		}
+		text = number.String()
+	}
+
+	value := new(big.Int)
+	text = strings.TrimSpace(text)
+	var ok bool
+	if strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X") {
+		_, ok = value.SetString(text[2:], 16)
+	} else {
+		_, ok = value.SetString(text, 10)
+	}
+	if !ok || value.Sign() < 0 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidQuantity, truncate(text, maxLoggedBodyBytes))
+	}
+
+	return "0x" + value.Text(16), nil
+}
+
+// maxRetriesFor returns how many times a failed call to method is retried: its entry in
+// MAX_RETRIES_OVERRIDES ("eth_getBalance=5,eth_getLogs=1") if any, else MAX_RETRIES (3 by default).
+// Overrides let cheap reads retry more than heavy or non-idempotent calls.
+func maxRetriesFor(method string) int {
+	for _, entry := range strings.Split(utils.GetEnv("MAX_RETRIES_OVERRIDES"), ",") {
+		overrideMethod, value, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || strings.TrimSpace(overrideMethod) != method {
+			continue
+		}
+
+		retries, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || retries < 0 {
+			utils.Logger.WithField("entry", entry).Warn("Ignoring invalid MAX_RETRIES_OVERRIDES entry")
+			break
+		}
+		return retries
+	}
+
+	raw := utils.GetEnv("MAX_RETRIES")
+	if raw == "" {
+		return 3 // Default to 3 retries if not specified.
+	}
+	retries, err := strconv.Atoi(raw)
+	if err != nil || retries < 0 {
+		utils.Logger.WithField("value", raw).Warn("Ignoring invalid MAX_RETRIES, using 3")
+		return 3
+	}
+	return retries
+}
+
+// isNullResult reports whether a JSON-RPC result is missing, null or an empty string.
+func isNullResult(raw json.RawMessage) bool {
+	switch strings.TrimSpace(string(raw)) {
+	case "", "null", `""`:
+		return true
+	}
+	return false
+}
+
+// truncate shortens s to at most n bytes, marking when it was cut.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "...(truncated)"
 }
@@ -1,10 +1,26 @@
 package nodemanager
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/luishsr/eth-proxy/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // TestGetBalance tests the GetBalance function of the ClientManager
@@ -33,6 +49,33 @@ func TestGetBalance(t *testing.T) {
 	}
 }
 
+// TestGetBalanceAtBlock verifies the block tag is passed upstream and cached separately per block
+func TestGetBalanceAtBlock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload jsonRPCPayload
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload.Method == "eth_blockNumber" {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+			return
+		}
+		// Echo the block back as the balance.
+		_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"%s"}`, strings.Replace(payload.Params[1].(string), "latest", "0x10", 1))
+	}))
+	defer server.Close()
+
+	manager := NewClientManager([]NodeConfig{{Name: "MockNode", URL: server.URL}}, &http.Client{})
+	address := "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+	for _, block := range []string{"latest", "0x5", "latest"} {
+		expected := strings.Replace(block, "latest", "0x10", 1)
+		if balance, err := manager.GetBalanceAtBlock(address, block); err != nil || balance != expected {
+			t.Errorf("GetBalanceAtBlock at %s = %s, %v; want %s", block, balance, err, expected)
+		}
+	}
+	if _, err := manager.GetBalanceAtBlock(address, "0xZZ"); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("Expected ErrInvalidBlock for a malformed block, got %v", err)
+	}
+}
+
 // Mock Ethereum node response
 func mockEthereumNode(response string, statusCode int) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -59,3 +102,1899 @@ func unsetEnv(t *testing.T, key string) {
 		t.Fatalf("Failed to unset environment variable: %s", err)
 	}
 }
+
+// TestCheckNodeHealthCustomPayload verifies a node is probed with its configured health-check method
+func TestCheckNodeHealthCustomPayload(t *testing.T) {
+	methods := make(chan string, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload jsonRPCPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode health-check payload: %v", err)
+		}
+		methods <- payload.Method
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0xaa36a7"}`))
+	}))
+	defer mockServer.Close()
+
+	healthCheck, err := ParseHealthCheckPayload(`{"method":"eth_chainId","params":[]}`)
+	if err != nil {
+		t.Fatalf("Expected valid health-check payload, got %v", err)
+	}
+
+	manager := NewClientManager([]NodeConfig{{Name: "L2Node", URL: mockServer.URL, HealthCheck: healthCheck}}, &http.Client{})
+	manager.CheckNodeHealth(manager.Nodes[0])
+
+	if method := <-methods; method != "eth_chainId" {
+		t.Fatalf("Expected node to be probed with eth_chainId, got %s", method)
+	}
+	if !manager.Nodes[0].Healthy {
+		t.Fatalf("Expected node to be healthy after a successful probe")
+	}
+}
+
+// TestParseHealthCheckPayloadInvalid verifies malformed templates are rejected at load time
+func TestParseHealthCheckPayloadInvalid(t *testing.T) {
+	for _, raw := range []string{`not json`, `{"params":[]}`, `{"method":"eth_chainId","extra":1}`} {
+		if _, err := ParseHealthCheckPayload(raw); err == nil {
+			t.Errorf("Expected error for payload %s", raw)
+		}
+	}
+}
+
+// TestCheckAllNodes verifies all nodes are probed concurrently and their statuses reflect the responses
+func TestCheckAllNodes(t *testing.T) {
+	const nodeCount = 3
+	var arrived sync.WaitGroup
+	arrived.Add(nodeCount)
+
+	// Each mock node only answers once every node has been probed, so a sequential
+	// implementation would time out instead of completing.
+	newNode := func(statusCode int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			arrived.Done()
+			arrived.Wait()
+			w.WriteHeader(statusCode)
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"Geth/v1.13.0"}`))
+		}))
+	}
+
+	up1, up2, down := newNode(http.StatusOK), newNode(http.StatusOK), newNode(http.StatusBadGateway)
+	defer up1.Close()
+	defer up2.Close()
+	defer down.Close()
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "Up1", URL: up1.URL},
+		{Name: "Down", URL: down.URL},
+		{Name: "Up2", URL: up2.URL},
+	}, &http.Client{Timeout: 2 * time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	statuses := manager.CheckAllNodes(ctx)
+
+	expected := map[string]bool{"Up1": true, "Down": false, "Up2": true}
+	if len(statuses) != nodeCount {
+		t.Fatalf("Expected %d statuses, got %d", nodeCount, len(statuses))
+	}
+	for _, status := range statuses {
+		if status.Healthy != expected[status.Name] {
+			t.Errorf("Node %s: expected healthy=%v, got %+v", status.Name, expected[status.Name], status)
+		}
+	}
+	if manager.Nodes[1].Healthy {
+		t.Errorf("Expected stored health state of Down to be updated to unhealthy")
+	}
+}
+
+// TestFunctionalHealthCheck verifies a live node that cannot serve balances is unhealthy under functional checking
+func TestFunctionalHealthCheck(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload jsonRPCPayload
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload.Method == "eth_getBalance" {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not enabled"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"Geth/v1.13.0"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := NewClientManager([]NodeConfig{{Name: "GatedNode", URL: mockServer.URL}}, &http.Client{})
+	node := manager.Nodes[0]
+
+	manager.CheckNodeHealth(node)
+	if !node.Healthy || node.FunctionalHealthy != nil {
+		t.Fatalf("Expected the liveness check alone to pass, got healthy=%v functional=%v", node.Healthy, node.FunctionalHealthy)
+	}
+
+	setEnv(t, "FUNCTIONAL_HEALTHCHECK", "true")
+	defer unsetEnv(t, "FUNCTIONAL_HEALTHCHECK")
+
+	manager.CheckNodeHealth(node)
+	if node.Healthy {
+		t.Errorf("Expected the node to be unhealthy when eth_getBalance fails")
+	}
+	if node.FunctionalHealthy == nil || *node.FunctionalHealthy {
+		t.Errorf("Expected the failed functional check to be recorded, got %v", node.FunctionalHealthy)
+	}
+}
+
+// TestSelfTest verifies the self-test tells working nodes from misconfigured ones
+func TestSelfTest(t *testing.T) {
+	goodNode := mockEthereumNode(`{"jsonrpc":"2.0","id":1,"result":"0x1234"}`, http.StatusOK)
+	defer goodNode.Close()
+	unauthorizedNode := mockEthereumNode(`{"error":"invalid project id"}`, http.StatusUnauthorized)
+	defer unauthorizedNode.Close()
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "GoodNode", URL: goodNode.URL},
+		{Name: "BadAuthNode", URL: unauthorizedNode.URL},
+	}, &http.Client{})
+
+	results := manager.SelfTest(context.Background())
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if !results[0].Passed || results[0].Balance != "0x1234" {
+		t.Errorf("Expected GoodNode to pass, got %+v", results[0])
+	}
+	if results[1].Passed || !strings.Contains(results[1].Error, "401") {
+		t.Errorf("Expected BadAuthNode to fail with its status code, got %+v", results[1])
+	}
+}
+
+// TestNodeGauges verifies a node going down lowers the healthy gauge while the configured gauge holds
+func TestNodeGauges(t *testing.T) {
+	upNode := mockEthereumNode(`{"jsonrpc":"2.0","id":1,"result":"Geth/v1.13.0"}`, http.StatusOK)
+	defer upNode.Close()
+	downNode := mockEthereumNode(`{}`, http.StatusBadGateway)
+	defer downNode.Close()
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "UpNode", URL: upNode.URL},
+		{Name: "DownNode", URL: downNode.URL},
+	}, &http.Client{})
+	if configured, healthy := gaugeValue(t, NodesConfigured), gaugeValue(t, NodesHealthy); configured != 2 || healthy != 2 {
+		t.Fatalf("Expected 2 configured and 2 healthy nodes, got %v and %v", configured, healthy)
+	}
+
+	manager.CheckAllNodes(context.Background())
+	if configured, healthy := gaugeValue(t, NodesConfigured), gaugeValue(t, NodesHealthy); configured != 2 || healthy != 1 {
+		t.Errorf("Expected 2 configured and 1 healthy node, got %v and %v", configured, healthy)
+	}
+}
+
+// TestCheckAllNodesCallerCancelled verifies a probe abandoned by the caller leaves node state unchanged
+func TestCheckAllNodesCallerCancelled(t *testing.T) {
+	release := make(chan struct{})
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer mockServer.Close()
+	defer close(release)
+
+	manager := NewClientManager([]NodeConfig{{Name: "Slow", URL: mockServer.URL}}, &http.Client{Timeout: 2 * time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	statuses := manager.CheckAllNodes(ctx)
+
+	if statuses[0].Error == "" {
+		t.Errorf("Expected the cancelled probe to report an error")
+	}
+	if !manager.Nodes[0].Healthy || manager.Nodes[0].ErrorCount != 0 {
+		t.Errorf("Expected node state to be untouched, got healthy=%v errorCount=%d", manager.Nodes[0].Healthy, manager.Nodes[0].ErrorCount)
+	}
+}
+
+// TestGetBalanceHashedCacheKeys verifies cache hits and misses when cache keys are hashed
+func TestGetBalanceHashedCacheKeys(t *testing.T) {
+	setEnv(t, "CACHE_HASH_KEYS", "true")
+	defer unsetEnv(t, "CACHE_HASH_KEYS")
+
+	var calls int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := NewClientManager([]NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	address := "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+
+	for i := 0; i < 2; i++ {
+		if _, err := manager.GetBalance(address); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("Expected the second lookup to be a cache hit, node was called %d times", got)
+	}
+
+	key, canonical := cacheKey("eth_getBalance", []interface{}{address, "latest"})
+	if len(key) != 64 || key == canonical {
+		t.Fatalf("Expected a fixed-size hashed key, got %q", key)
+	}
+
+	// A different address must miss.
+	if _, err := manager.GetBalance("0x5E447e8ecAAaaF0a2fe87fd0B6CF3C02DfBC336f"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("Expected a cache miss for a different address, node was called %d times", got)
+	}
+
+	// An entry stored under the same hash for a different canonical key must not be served.
+	manager.Cache[key] = CacheItem{Balance: "0xbad", Timestamp: time.Now(), Key: "eth_getBalance:[\"0xother\",\"latest\"]"}
+	if _, found := manager.getCached("eth_getBalance", []interface{}{address, "latest"}); found {
+		t.Fatalf("Expected a colliding cache entry to be treated as a miss")
+	}
+}
+
+// TestGetBalanceResultRaw verifies the upstream response body is returned and served from cache
+func TestGetBalanceResultRaw(t *testing.T) {
+	response := `{"jsonrpc":"2.0","id":1,"result":"0x2a"}`
+	mockServer := mockEthereumNode(response, http.StatusOK)
+	defer mockServer.Close()
+
+	manager := NewClientManager([]NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	address := "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+
+	for i := 0; i < 2; i++ {
+		result, err := manager.GetBalanceResult(context.Background(), address)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if string(result.Raw) != response || result.Balance != "0x2a" {
+			t.Fatalf("Unexpected result on attempt %d: %+v", i+1, result)
+		}
+	}
+}
+
+// TestGetBalanceOversizedResponse verifies an oversized node response triggers a failover
+func TestGetBalanceOversizedResponse(t *testing.T) {
+	setEnv(t, "MAX_UPSTREAM_RESPONSE_BYTES", "128")
+	defer unsetEnv(t, "MAX_UPSTREAM_RESPONSE_BYTES")
+	setEnv(t, "REQUEST_FAILURE_THRESHOLD", "1")
+	defer unsetEnv(t, "REQUEST_FAILURE_THRESHOLD")
+
+	oversized := `{"jsonrpc":"2.0","id":1,"result":"0x` + strings.Repeat("f", 512) + `"}`
+	bigServer := mockEthereumNode(oversized, http.StatusOK)
+	defer bigServer.Close()
+	goodServer := mockEthereumNode(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`, http.StatusOK)
+	defer goodServer.Close()
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "BigNode", URL: bigServer.URL},
+		{Name: "GoodNode", URL: goodServer.URL},
+	}, &http.Client{})
+
+	balance, err := manager.GetBalance("0x00a3Ac5E156B4B291ceB59D019121beB6508d93D")
+	if err != nil {
+		t.Fatalf("Expected failover to succeed, got %v", err)
+	}
+	if balance != "0x1" {
+		t.Fatalf("Expected balance from GoodNode, got %s", balance)
+	}
+	if manager.Nodes[0].Healthy {
+		t.Fatalf("Expected BigNode to be marked unhealthy after exceeding the size limit")
+	}
+}
+
+// TestGetBalanceRetriableRPCCodes verifies only configured JSON-RPC error codes are retried on another node
+func TestGetBalanceRetriableRPCCodes(t *testing.T) {
+	setEnv(t, "RETRIABLE_RPC_CODES", "-32005")
+	defer unsetEnv(t, "RETRIABLE_RPC_CODES")
+
+	tests := []struct {
+		name          string
+		errorCode     int
+		expectRetried bool
+	}{
+		{name: "Configured retriable code", errorCode: -32005, expectRetried: true},
+		{name: "Non-listed code", errorCode: -32602, expectRetried: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			failing := mockEthereumNode(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"error":{"code":%d,"message":"rpc error"}}`, tc.errorCode), http.StatusOK)
+			defer failing.Close()
+
+			var calls int32
+			fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+			}))
+			defer fallback.Close()
+
+			manager := NewClientManager([]NodeConfig{
+				{Name: "FailingNode", URL: failing.URL},
+				{Name: "FallbackNode", URL: fallback.URL},
+			}, &http.Client{})
+
+			_, err := manager.GetBalance("0x00a3Ac5E156B4B291ceB59D019121beB6508d93D")
+			retried := atomic.LoadInt32(&calls) > 0
+			if retried != tc.expectRetried {
+				t.Fatalf("Expected retried=%v, got %v (err: %v)", tc.expectRetried, retried, err)
+			}
+
+			var rpcErr *RPCError
+			if !tc.expectRetried && (!errors.As(err, &rpcErr) || rpcErr.Code != tc.errorCode) {
+				t.Fatalf("Expected the node's RPC error to be returned, got %v", err)
+			}
+		})
+	}
+}
+
+// TestGetBalanceDecodeError verifies a non-JSON response is counted and fails over to another node
+func TestGetBalanceDecodeError(t *testing.T) {
+	htmlServer := mockEthereumNode(`<html><body>502 Bad Gateway</body></html>`, http.StatusOK)
+	defer htmlServer.Close()
+	goodServer := mockEthereumNode(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`, http.StatusOK)
+	defer goodServer.Close()
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "HTMLNode", URL: htmlServer.URL},
+		{Name: "GoodNode", URL: goodServer.URL},
+	}, &http.Client{})
+
+	before := counterValue(t, UpstreamDecodeErrors.WithLabelValues("HTMLNode"))
+
+	balance, err := manager.GetBalance("0x00a3Ac5E156B4B291ceB59D019121beB6508d93D")
+	if err != nil || balance != "0x1" {
+		t.Fatalf("Expected failover to GoodNode, got balance %q and error %v", balance, err)
+	}
+	if got := counterValue(t, UpstreamDecodeErrors.WithLabelValues("HTMLNode")); got != before+1 {
+		t.Fatalf("Expected decode error counter to increment, went from %v to %v", before, got)
+	}
+}
+
+// counterValue reads the current value of a Prometheus counter
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	t.Helper()
+	var metric dto.Metric
+	if err := counter.Write(&metric); err != nil {
+		t.Fatalf("Failed to read counter: %v", err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+// TestGetBalanceRefreshFailurePolicy verifies an expired entry is served stale or errors per ON_REFRESH_FAILURE
+func TestGetBalanceRefreshFailurePolicy(t *testing.T) {
+	failing := mockEthereumNode(`upstream unavailable`, http.StatusServiceUnavailable)
+	defer failing.Close()
+
+	address := "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+	params := []interface{}{address, "latest"}
+
+	for _, policy := range []string{"serve_stale", `"serve_stale"`, "error"} {
+		t.Run(policy, func(t *testing.T) {
+			setEnv(t, "ON_REFRESH_FAILURE", policy)
+			defer unsetEnv(t, "ON_REFRESH_FAILURE")
+
+			manager := NewClientManager([]NodeConfig{{Name: "FailingNode", URL: failing.URL}}, &http.Client{})
+			manager.setCached("eth_getBalance", params, "0x7", nil, time.Now(), time.Minute, "Node")
+			key, _ := cacheKey("eth_getBalance", params)
+			expired := manager.Cache[key]
+			expired.Timestamp = time.Now().Add(-time.Hour)
+			manager.Cache[key] = expired
+
+			result, err := manager.GetBalanceResult(context.Background(), address)
+			if strings.Contains(policy, "serve_stale") {
+				if err != nil || result.Balance != "0x7" || !result.Stale {
+					t.Fatalf("Expected stale balance 0x7, got %+v and error %v", result, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected an error when refresh fails, got %+v", result)
+			}
+		})
+	}
+}
+
+// TestQuotedListEnvVars verifies list-valued settings are read with surrounding quotes trimmed
+func TestQuotedListEnvVars(t *testing.T) {
+	setEnv(t, "RETRIABLE_RPC_CODES", `"-32000, 3"`)
+	defer unsetEnv(t, "RETRIABLE_RPC_CODES")
+	setEnv(t, "MAX_RETRIES_OVERRIDES", `'eth_getLogs=1'`)
+	defer unsetEnv(t, "MAX_RETRIES_OVERRIDES")
+	setEnv(t, "CACHE_TTL_OVERRIDES", ` "0xhot=5" `)
+	defer unsetEnv(t, "CACHE_TTL_OVERRIDES")
+
+	if !isRetriableRPCCode(-32000) || !isRetriableRPCCode(3) {
+		t.Errorf("Expected quoted RETRIABLE_RPC_CODES entries to be honored")
+	}
+	if got := maxRetriesFor("eth_getLogs"); got != 1 {
+		t.Errorf("Expected the quoted MAX_RETRIES_OVERRIDES entry to apply, got %d retries", got)
+	}
+	if got := balanceCacheTTL("0xhot"); got != 5*time.Second {
+		t.Errorf("Expected the quoted CACHE_TTL_OVERRIDES entry to apply, got %s", got)
+	}
+}
+
+// TestSelectionStatsRoundRobin verifies the fairness report shows an even round-robin distribution
+func TestSelectionStatsRoundRobin(t *testing.T) {
+	setEnv(t, "SELECTION_WINDOW", "30")
+	defer unsetEnv(t, "SELECTION_WINDOW")
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "NodeA", URL: "http://node-a"},
+		{Name: "NodeB", URL: "http://node-b"},
+		{Name: "NodeC", URL: "http://node-c"},
+	}, &http.Client{})
+
+	// Overfill the window so only the most recent selections count.
+	for i := 0; i < 45; i++ {
+		manager.NextNode()
+	}
+
+	for _, share := range manager.SelectionStats() {
+		if share.Selections != 10 || share.ActualShare != share.ExpectedShare {
+			t.Errorf("Expected an even share for %s, got %+v", share.Node, share)
+		}
+	}
+}
+
+// TestSelectionStatsIneligibleNodes verifies expected shares only cover healthy, non-draining nodes
+func TestSelectionStatsIneligibleNodes(t *testing.T) {
+	manager := NewClientManager([]NodeConfig{
+		{Name: "NodeA", URL: "http://node-a"},
+		{Name: "NodeB", URL: "http://node-b"},
+		{Name: "NodeC", URL: "http://node-c"},
+		{Name: "NodeD", URL: "http://node-d"},
+	}, &http.Client{})
+	manager.Nodes[1].Healthy = false
+	manager.Nodes[2].Draining = true
+
+	for i := 0; i < 10; i++ {
+		manager.NextNode()
+	}
+
+	expected := map[string]float64{"NodeA": 0.5, "NodeB": 0, "NodeC": 0, "NodeD": 0.5}
+	for _, share := range manager.SelectionStats() {
+		if share.ExpectedShare != expected[share.Node] || share.Eligible != (expected[share.Node] > 0) {
+			t.Errorf("Unexpected share for %s: %+v", share.Node, share)
+		}
+		if share.ActualShare != share.ExpectedShare {
+			t.Errorf("Expected %s's actual share to match its expected share, got %+v", share.Node, share)
+		}
+	}
+}
+
+// TestParseQuantity verifies hex, decimal and numeric results are normalized and garbage is rejected
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected string
+		wantErr  bool
+	}{
+		{name: "Hex", raw: `"0x10"`, expected: "0x10"},
+		{name: "Hex with leading zeros and uppercase", raw: `"0x00FF"`, expected: "0xff"},
+		{name: "Zero", raw: `"0x0"`, expected: "0x0"},
+		{name: "Decimal string", raw: `"16"`, expected: "0x10"},
+		{name: "Bare number", raw: `16`, expected: "0x10"},
+		{name: "Large decimal", raw: `"1000000000000000000000"`, expected: "0x3635c9adc5dea00000"},
+		{name: "Garbage string", raw: `"lots"`, wantErr: true},
+		{name: "Invalid hex", raw: `"0xzz"`, wantErr: true},
+		{name: "Negative", raw: `"-1"`, wantErr: true},
+		{name: "Object", raw: `{"balance":1}`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseQuantity(json.RawMessage(tc.raw))
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidQuantity) {
+					t.Fatalf("Expected ErrInvalidQuantity, got %q and %v", got, err)
+				}
+				return
+			}
+			if err != nil || got != tc.expected {
+				t.Fatalf("Expected %s, got %q and %v", tc.expected, got, err)
+			}
+		})
+	}
+}
+
+// TestGetBalanceNullResultFailsOver verifies a null result is retried on another node and never cached
+func TestGetBalanceNullResultFailsOver(t *testing.T) {
+	nullNode := mockEthereumNode(`{"jsonrpc":"2.0","id":1,"result":null}`, http.StatusOK)
+	defer nullNode.Close()
+	goodNode := mockEthereumNode(`{"jsonrpc":"2.0","id":1,"result":"0x1234"}`, http.StatusOK)
+	defer goodNode.Close()
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "NullNode", URL: nullNode.URL},
+		{Name: "GoodNode", URL: goodNode.URL},
+	}, &http.Client{})
+	manager.index = 0
+
+	address := "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+	result, err := manager.GetBalanceResult(context.Background(), address)
+	if err != nil || result.Balance != "0x1234" {
+		t.Fatalf("Expected failover to GoodNode with 0x1234, got %+v, %v", result, err)
+	}
+	for key, item := range manager.Cache {
+		if item.Balance != "0x1234" {
+			t.Errorf("Expected no bogus cache entry, got %s=%q", key, item.Balance)
+		}
+	}
+
+	// With no other node to fall back to, the null result surfaces as an error.
+	setEnv(t, "MAX_RETRIES", "1")
+	defer unsetEnv(t, "MAX_RETRIES")
+	manager = NewClientManager([]NodeConfig{{Name: "NullNode", URL: nullNode.URL}}, &http.Client{})
+	if _, err := manager.GetBalanceResult(context.Background(), address); !errors.Is(err, ErrNullResult) {
+		t.Errorf("Expected ErrNullResult, got %v", err)
+	}
+	if len(manager.Cache) != 0 {
+		t.Errorf("Expected nothing to be cached, got %d entries", len(manager.Cache))
+	}
+}
+
+// TestCallMaxRetriesOverride verifies a method with a retry override uses it instead of MAX_RETRIES
+func TestCallMaxRetriesOverride(t *testing.T) {
+	setEnv(t, "MAX_RETRIES", "3")
+	defer unsetEnv(t, "MAX_RETRIES")
+	setEnv(t, "MAX_RETRIES_OVERRIDES", "eth_getLogs=1")
+	defer unsetEnv(t, "MAX_RETRIES_OVERRIDES")
+	// Keep the failing node in rotation for every attempt.
+	setEnv(t, "REQUEST_FAILURE_THRESHOLD", "100")
+	defer unsetEnv(t, "REQUEST_FAILURE_THRESHOLD")
+
+	calls := make(map[string]int)
+	var mu sync.Mutex
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload jsonRPCPayload
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		calls[payload.Method]++
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer mockServer.Close()
+
+	manager := NewClientManager([]NodeConfig{{Name: "FailingNode", URL: mockServer.URL}}, &http.Client{})
+	for _, method := range []string{"eth_getLogs", "eth_blockNumber"} {
+		if _, err := manager.Call(context.Background(), method, []interface{}{}); err == nil {
+			t.Fatalf("Expected %s to fail", method)
+		}
+	}
+
+	if calls["eth_getLogs"] != 2 {
+		t.Errorf("Expected eth_getLogs to be attempted twice, got %d", calls["eth_getLogs"])
+	}
+	if calls["eth_blockNumber"] != 4 {
+		t.Errorf("Expected eth_blockNumber to use MAX_RETRIES and be attempted 4 times, got %d", calls["eth_blockNumber"])
+	}
+}
+
+// TestUpstreamStale verifies the stale gauge flips when only cached balances are served and clears on recovery
+func TestUpstreamStale(t *testing.T) {
+	setEnv(t, "UPSTREAM_STALE_SECONDS", "1")
+	defer unsetEnv(t, "UPSTREAM_STALE_SECONDS")
+
+	var failing int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := NewClientManager([]NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	address := "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+	if _, err := manager.GetBalance(address); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Upstream breaks and the last success falls outside the window while the cache keeps serving.
+	atomic.StoreInt32(&failing, 1)
+	manager.mu.Lock()
+	manager.lastUpstreamSuccess = time.Now().Add(-2 * time.Second)
+	manager.mu.Unlock()
+
+	if _, err := manager.GetBalance(address); err != nil {
+		t.Fatalf("Expected a cached balance, got %v", err)
+	}
+	if value := gaugeValue(t, UpstreamStale); value != 1 {
+		t.Fatalf("Expected the stale gauge to be raised, got %v", value)
+	}
+
+	// A successful fetch clears it.
+	atomic.StoreInt32(&failing, 0)
+	if _, err := manager.GetBalanceAt(context.Background(), address, "pending"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value := gaugeValue(t, UpstreamStale); value != 0 {
+		t.Errorf("Expected the stale gauge to clear after a successful fetch, got %v", value)
+	}
+}
+
+// TestSetCachedKeepsNewest verifies out-of-order cache writes never replace a newer balance with an older one
+func TestSetCachedKeepsNewest(t *testing.T) {
+	manager := NewClientManager(nil, &http.Client{})
+	params := []interface{}{"0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", "latest"}
+	base := time.Now()
+
+	// Writers finish in shuffled order; the value fetched last must survive.
+	const writers = 50
+	var wg sync.WaitGroup
+	for _, i := range rand.Perm(writers) {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			manager.setCached("eth_getBalance", params, fmt.Sprintf("0x%x", i), nil, base.Add(time.Duration(i)*time.Millisecond), time.Minute, "Node")
+		}(i)
+	}
+	wg.Wait()
+
+	item, found := manager.getCached("eth_getBalance", params)
+	if expected := fmt.Sprintf("0x%x", writers-1); !found || item.Balance != expected {
+		t.Fatalf("Expected the newest balance %s to survive, got %q", expected, item.Balance)
+	}
+
+	// With last-writer-wins, an older write replaces it.
+	setEnv(t, "CACHE_WRITE_POLICY", "last_write")
+	defer unsetEnv(t, "CACHE_WRITE_POLICY")
+	manager.setCached("eth_getBalance", params, "0xold", nil, base, time.Minute, "Node")
+	if item, _ := manager.getCached("eth_getBalance", params); item.Balance != "0xold" {
+		t.Errorf("Expected last_write to keep the last write, got %q", item.Balance)
+	}
+}
+
+// TestGetBalanceGetTransport verifies nodes configured for GET receive query-encoded JSON-RPC calls
+func TestGetBalanceGetTransport(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.Method != http.MethodGet || query.Get("method") != "eth_getBalance" ||
+			query.Get("params") != `["0x00a3Ac5E156B4B291ceB59D019121beB6508d93D","latest"]` {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1234"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := NewClientManager([]NodeConfig{{Name: "GetNode", URL: mockServer.URL, Method: http.MethodGet}}, &http.Client{})
+
+	balance, err := manager.GetBalance("0x00a3Ac5E156B4B291ceB59D019121beB6508d93D")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if balance != "0x1234" {
+		t.Errorf("Expected balance 0x1234, got %s", balance)
+	}
+}
+
+// TestSharedValueLeaderCancelled verifies a caller waiting on a shared refresh still gets the value
+// when the caller that started the refresh gives up
+func TestSharedValueLeaderCancelled(t *testing.T) {
+	var shared sharedValue
+	started, release := make(chan struct{}), make(chan struct{})
+	fetch := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return "0x1", nil
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := shared.get(leaderCtx, time.Minute, fetch)
+		leaderErr <- err
+	}()
+	<-started
+
+	waiter := make(chan interface{}, 1)
+	go func() {
+		value, err := shared.get(context.Background(), time.Minute, fetch)
+		if err != nil {
+			value = err
+		}
+		waiter <- value
+	}()
+	time.Sleep(20 * time.Millisecond) // Let the waiter join the in-flight refresh.
+
+	cancel()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the leader to give up with its own error, got %v", err)
+	}
+	close(release)
+	if value := <-waiter; value != "0x1" {
+		t.Errorf("Expected the waiter to get the refreshed value, got %v", value)
+	}
+}
+
+// TestGetEthUsdPriceStampede verifies concurrent price lookups refresh upstream once per cache window
+func TestGetEthUsdPriceStampede(t *testing.T) {
+	roundData := "0x" + strings.Repeat("0", 64) + fmt.Sprintf("%064x", 2000*100000000) + strings.Repeat("0", 3*64)
+
+	var hits int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(50 * time.Millisecond) // Keep the refresh in flight while other callers arrive.
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"` + roundData + `"}`))
+	}))
+	defer mockServer.Close()
+
+	setEnv(t, "PRICE_FEED_ADDRESS", "0x694AA1769357215DE4FAC081bf1f309aDC325306")
+	defer unsetEnv(t, "PRICE_FEED_ADDRESS")
+	setEnv(t, "PRICE_CACHE_SECONDS", "1")
+	defer unsetEnv(t, "PRICE_CACHE_SECONDS")
+
+	manager := NewClientManager([]NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+
+	hammer := func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				price, err := manager.GetEthUsdPrice(context.Background())
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+					return
+				}
+				if price.FloatString(2) != "2000.00" {
+					t.Errorf("Expected price 2000.00, got %s", price.FloatString(2))
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	// A cold cache is filled by a single upstream call shared by all callers.
+	hammer()
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("Expected 1 upstream call for a cold cache, got %d", got)
+	}
+
+	// Once expired, callers are served the stale price while exactly one refresh runs.
+	time.Sleep(1100 * time.Millisecond)
+	hammer()
+	time.Sleep(100 * time.Millisecond) // Let the background refresh finish.
+	if got := atomic.LoadInt32(&hits); got != 2 {
+		t.Fatalf("Expected 2 upstream calls after one expiry, got %d", got)
+	}
+}
+
+// TestNextNodeDeterministicOrder verifies selection follows configuration order from the seeded start
+func TestNextNodeDeterministicOrder(t *testing.T) {
+	setEnv(t, "ROUND_ROBIN_SEED", "1")
+	defer unsetEnv(t, "ROUND_ROBIN_SEED")
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "A", URL: "http://a"},
+		{Name: "B", URL: "http://b"},
+		{Name: "C", URL: "http://c"},
+		{Name: "D", URL: "http://d"},
+	}, &http.Client{})
+	manager.Nodes[2].Healthy = false
+
+	selectSequence := func(n int) []string {
+		var names []string
+		for i := 0; i < n; i++ {
+			names = append(names, manager.NextNode().Name)
+		}
+		return names
+	}
+
+	expected := []string{"B", "D", "A", "B", "D"}
+	if got := selectSequence(5); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected sequence %v, got %v", expected, got)
+	}
+
+	manager.ResetRoundRobin(0)
+	expected = []string{"A", "B", "D"}
+	if got := selectSequence(3); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected sequence %v after reset, got %v", expected, got)
+	}
+}
+
+// TestNextNodeInRegion verifies same-region nodes are preferred, falling back across regions
+func TestNextNodeInRegion(t *testing.T) {
+	manager := NewClientManager([]NodeConfig{
+		{Name: "US1", URL: "http://us1", Region: "us-east"},
+		{Name: "EU1", URL: "http://eu1", Region: "eu-west"},
+		{Name: "US2", URL: "http://us2", Region: "us-east"},
+		{Name: "EU2", URL: "http://eu2", Region: "eu-west"},
+	}, &http.Client{})
+
+	var names []string
+	for i := 0; i < 4; i++ {
+		names = append(names, manager.NextNodeInRegion("eu-west").Name)
+	}
+	if expected := "EU1,EU2,EU1,EU2"; strings.Join(names, ",") != expected {
+		t.Errorf("Expected same-region round-robin %s, got %v", expected, names)
+	}
+
+	manager.Nodes[1].Healthy = false
+	manager.Nodes[3].Healthy = false
+	if node := manager.NextNodeInRegion("eu-west"); node == nil || node.Region != "us-east" {
+		t.Errorf("Expected a cross-region fallback when eu-west is down, got %v", node)
+	}
+	if node := manager.NextNodeInRegion("ap-south"); node == nil {
+		t.Errorf("Expected a node for a region without nodes")
+	}
+}
+
+// TestRetryLeavesFailedRegionNode verifies a retry moves on to another region when the only node in
+// the client's region fails, even when request failures do not demote nodes
+func TestRetryLeavesFailedRegionNode(t *testing.T) {
+	setEnv(t, "DEMOTE_ON_REQUEST_FAILURE", "false")
+	defer unsetEnv(t, "DEMOTE_ON_REQUEST_FAILURE")
+
+	var localCalls, remoteCalls int32
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&localCalls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer local.Close()
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&remoteCalls, 1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+	}))
+	defer remote.Close()
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "Local", URL: local.URL, Region: "eu-west"},
+		{Name: "Remote", URL: remote.URL, Region: "us-east"},
+	}, &http.Client{})
+
+	result, err := manager.GetBalanceResult(WithClientRegion(context.Background(), "eu-west"), "0x5E447e8ecAAaaF0a2fe87fd0B6CF3C02DfBC336f")
+	if err != nil || result.Balance != "0x10" {
+		t.Fatalf("Expected the retry to succeed cross-region, got %v, %v", result, err)
+	}
+	if local, remote := atomic.LoadInt32(&localCalls), atomic.LoadInt32(&remoteCalls); local != 1 || remote != 1 {
+		t.Errorf("Expected one attempt on each node, got %d local and %d remote", local, remote)
+	}
+}
+
+// TestMaintenanceWindow verifies a node is skipped during its maintenance window and selectable outside it
+func TestMaintenanceWindow(t *testing.T) {
+	now := time.Now().UTC()
+	window := func(from, to time.Duration) []MaintenanceWindow {
+		windows, err := ParseMaintenanceWindows(now.Add(from).Format("15:04") + "-" + now.Add(to).Format("15:04"))
+		if err != nil {
+			t.Fatalf("Failed to parse maintenance window: %v", err)
+		}
+		return windows
+	}
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "Maintained", URL: "http://maintained", Maintenance: window(-time.Hour, time.Hour)},
+		{Name: "Other", URL: "http://other"},
+	}, &http.Client{})
+
+	for i := 0; i < 3; i++ {
+		if node := manager.NextNode(); node.Name != "Other" {
+			t.Fatalf("Expected the node in maintenance to be skipped, got %s", node.Name)
+		}
+	}
+
+	manager.Nodes[0].Maintenance = window(2*time.Hour, 3*time.Hour)
+	var names []string
+	for i := 0; i < 2; i++ {
+		names = append(names, manager.NextNode().Name)
+	}
+	if !strings.Contains(strings.Join(names, ","), "Maintained") {
+		t.Errorf("Expected the node to be selectable outside its window, got %v", names)
+	}
+
+	if _, err := ParseMaintenanceWindows("02:00"); err == nil {
+		t.Errorf("Expected a window without an end to be rejected")
+	}
+}
+
+// TestBlockTagAliases verifies standard block tags are rewritten to a node's configured aliases
+func TestBlockTagAliases(t *testing.T) {
+	params := make(chan []interface{}, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload jsonRPCPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		params <- payload.Params
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+	}))
+	defer mockServer.Close()
+
+	aliases, err := ParseBlockTagAliases("finalized=safe")
+	if err != nil {
+		t.Fatalf("Failed to parse block tag aliases: %v", err)
+	}
+	manager := NewClientManager([]NodeConfig{{Name: "Quirky", URL: mockServer.URL, BlockTagAliases: aliases}}, &http.Client{})
+
+	if _, err := manager.GetBalanceAt(context.Background(), "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", "finalized"); err != nil {
+		t.Fatalf("GetBalanceAt failed: %v", err)
+	}
+	if sent := <-params; len(sent) != 2 || sent[1] != "safe" {
+		t.Errorf("Expected finalized to be sent as safe, got %v", sent)
+	}
+
+	if _, err := ParseBlockTagAliases("newest=latest"); err == nil {
+		t.Errorf("Expected an alias for a non-standard tag to be rejected")
+	}
+}
+
+// TestNodeRateLimit verifies traffic shifts away from a node at its rate limit and waits for it otherwise
+func TestNodeRateLimit(t *testing.T) {
+	var limitedCalls, otherCalls int32
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&limitedCalls, 1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+	}))
+	defer limited.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&otherCalls, 1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+	}))
+	defer other.Close()
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "Limited", URL: limited.URL, RateLimit: 1},
+		{Name: "Other", URL: other.URL},
+	}, &http.Client{})
+	for i := 0; i < 6; i++ {
+		if _, err := manager.GetBalanceAt(context.Background(), fmt.Sprintf("0x%040x", i), "latest"); err != nil {
+			t.Fatalf("GetBalanceAt failed: %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&limitedCalls); got != 1 {
+		t.Errorf("Expected the limited node to serve 1 request, got %d (other node served %d)", got, atomic.LoadInt32(&otherCalls))
+	}
+
+	// With no other node, requests wait for the limit instead.
+	solo := NewClientManager([]NodeConfig{{Name: "Limited", URL: limited.URL, RateLimit: 10}}, &http.Client{})
+	start := time.Now()
+	for i := 0; i < 12; i++ {
+		if _, err := solo.GetBalanceAt(context.Background(), fmt.Sprintf("0x%040x", i), "latest"); err != nil {
+			t.Fatalf("GetBalanceAt failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Expected 12 requests at 10 rps to be throttled, took %v", elapsed)
+	}
+}
+
+// TestFairSelectionAfterFlapping verifies a flapping node catches up with its peers once it recovers
+func TestFairSelectionAfterFlapping(t *testing.T) {
+	setEnv(t, "ROUND_ROBIN_MAX_AGE_SECONDS", "3600")
+	defer unsetEnv(t, "ROUND_ROBIN_MAX_AGE_SECONDS")
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "A", URL: "http://a"},
+		{Name: "Flapping", URL: "http://flapping"},
+		{Name: "C", URL: "http://c"},
+	}, &http.Client{})
+
+	for i := 0; i < 600; i++ {
+		// Down for every other stretch of 10 selections during the first half.
+		manager.mu.Lock()
+		manager.Nodes[1].Healthy = i >= 300 || (i/10)%2 == 0
+		manager.mu.Unlock()
+
+		if manager.NextNode() == nil {
+			t.Fatalf("Expected a node to be selected")
+		}
+	}
+
+	for _, share := range manager.SelectionStats() {
+		if share.Selections < 199 || share.Selections > 201 {
+			t.Errorf("Expected %s to get about a third of 600 selections, got %d", share.Node, share.Selections)
+		}
+	}
+}
+
+// TestLatencyStrategy verifies LB_STRATEGY=latency prefers the fastest node and rotates among ties
+func TestLatencyStrategy(t *testing.T) {
+	setEnv(t, "LB_STRATEGY", "latency")
+	defer unsetEnv(t, "LB_STRATEGY")
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "Slow", URL: "http://slow"},
+		{Name: "Fast", URL: "http://fast"},
+		{Name: "Unmeasured", URL: "http://unmeasured"},
+	}, &http.Client{})
+	manager.Nodes[0].AvgLatency = 300 * time.Millisecond
+	manager.Nodes[1].AvgLatency = 20 * time.Millisecond
+
+	if node := manager.NextNode(); node == nil || node.Name != "Unmeasured" {
+		t.Fatalf("Expected the unmeasured node to be sampled first, got %v", node)
+	}
+	manager.Nodes[2].AvgLatency = 500 * time.Millisecond
+
+	for i := 0; i < 5; i++ {
+		if node := manager.NextNode(); node == nil || node.Name != "Fast" {
+			t.Fatalf("Expected the fastest node, got %v", node)
+		}
+	}
+
+	manager.Nodes[1].Healthy = false
+	if node := manager.NextNode(); node == nil || node.Name != "Slow" {
+		t.Fatalf("Expected the fastest healthy node, got %v", node)
+	}
+	manager.Nodes[1].Healthy = true
+
+	// Within latencyTolerance of each other, nodes take turns.
+	manager.Nodes[0].AvgLatency = 21 * time.Millisecond
+	manager.Nodes[2].AvgLatency = 21 * time.Millisecond
+	seen := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		seen[manager.NextNode().Name]++
+	}
+	for _, name := range []string{"Slow", "Fast", "Unmeasured"} {
+		if seen[name] != 10 {
+			t.Errorf("Expected tied nodes to rotate evenly, got %v", seen)
+			break
+		}
+	}
+}
+
+// TestLatencyStrategyRetriesOtherNode verifies a retry under LB_STRATEGY=latency moves on from a
+// failing node that still looks fastest
+func TestLatencyStrategyRetriesOtherNode(t *testing.T) {
+	setEnv(t, "LB_STRATEGY", "latency")
+	defer unsetEnv(t, "LB_STRATEGY")
+	setEnv(t, "DEMOTE_ON_REQUEST_FAILURE", "false")
+	defer unsetEnv(t, "DEMOTE_ON_REQUEST_FAILURE")
+
+	var failingCalls, workingCalls int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failingCalls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&workingCalls, 1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+	}))
+	defer working.Close()
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "Failing", URL: failing.URL},
+		{Name: "Working", URL: working.URL},
+	}, &http.Client{})
+	manager.Nodes[0].AvgLatency = time.Millisecond
+	manager.Nodes[1].AvgLatency = 200 * time.Millisecond
+
+	result, err := manager.GetBalanceResult(context.Background(), "0x5E447e8ecAAaaF0a2fe87fd0B6CF3C02DfBC336f")
+	if err != nil || result.Balance != "0x10" {
+		t.Fatalf("Expected the retry to reach the working node, got %v, %v", result, err)
+	}
+	if failed, worked := atomic.LoadInt32(&failingCalls), atomic.LoadInt32(&workingCalls); failed != 1 || worked != 1 {
+		t.Errorf("Expected one attempt on each node, got %d failing and %d working", failed, worked)
+	}
+}
+
+// TestArchiveNodeRouting verifies queries deeper than ARCHIVE_MIN_DEPTH go to archive nodes while
+// latest and recent ones do not, and fail clearly when no archive node is configured
+func TestArchiveNodeRouting(t *testing.T) {
+	setEnv(t, "ARCHIVE_MIN_DEPTH", "8")
+	defer unsetEnv(t, "ARCHIVE_MIN_DEPTH")
+
+	// Both nodes report 0x10 as the head block and as every balance.
+	serve := func(calls *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var payload jsonRPCPayload
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			if payload.Method != "eth_blockNumber" {
+				atomic.AddInt32(calls, 1)
+			}
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+		}))
+	}
+	var fullCalls, archiveCalls int32
+	full := serve(&fullCalls)
+	defer full.Close()
+	archive := serve(&archiveCalls)
+	defer archive.Close()
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "Full", URL: full.URL},
+		{Name: "Archive", URL: archive.URL, Archive: true},
+	}, &http.Client{})
+	address := "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+
+	for i, block := range []string{"latest", "latest", "0x10", "0x9"} {
+		if _, err := manager.GetBalanceAt(context.Background(), fmt.Sprintf("0x%040x", i), block); err != nil {
+			t.Fatalf("GetBalanceAt at %s failed: %v", block, err)
+		}
+	}
+	if got := atomic.LoadInt32(&archiveCalls); got != 0 {
+		t.Errorf("Expected latest and recent queries to stay off the archive node, got %d calls", got)
+	}
+
+	for _, block := range []string{"0x8", "earliest"} {
+		if _, err := manager.GetBalanceAt(context.Background(), address, block); err != nil {
+			t.Fatalf("GetBalanceAt at %s failed: %v", block, err)
+		}
+	}
+	if _, err := manager.GetStorageAt(context.Background(), address, "0x0", "0x1"); err != nil {
+		t.Fatalf("GetStorageAt failed: %v", err)
+	}
+	if got := atomic.LoadInt32(&archiveCalls); got != 3 {
+		t.Errorf("Expected 3 historical queries on the archive node, got %d", got)
+	}
+	if got := atomic.LoadInt32(&fullCalls); got != 4 {
+		t.Errorf("Expected only the 4 latest and recent queries on the full node, got %d", got)
+	}
+
+	manager.Nodes[1].Healthy = false
+	if _, err := manager.GetBalanceAt(context.Background(), address, "0x2"); !errors.Is(err, ErrNoArchiveNode) {
+		t.Errorf("Expected ErrNoArchiveNode with the archive node down, got %v", err)
+	}
+
+	// Without any archive node, recent queries are served and historical ones fail.
+	fullOnly := NewClientManager([]NodeConfig{{Name: "Full", URL: full.URL}}, &http.Client{})
+	if _, err := fullOnly.GetBalanceAt(context.Background(), address, "0xa"); err != nil {
+		t.Errorf("Expected a recent query to be served without archive nodes, got %v", err)
+	}
+	if _, err := fullOnly.GetBalanceAt(context.Background(), address, "0x2"); !errors.Is(err, ErrNoArchiveNode) {
+		t.Errorf("Expected ErrNoArchiveNode without archive nodes, got %v", err)
+	}
+}
+
+// TestNodeLatencyTracking verifies successful fetches record the node's latest and average latency
+func TestNodeLatencyTracking(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := NewClientManager([]NodeConfig{{Name: "LatencyNode", URL: mockServer.URL}}, &http.Client{})
+	for i := 0; i < 3; i++ {
+		if _, err := manager.GetBalanceAt(context.Background(), fmt.Sprintf("0x%040x", i), "latest"); err != nil {
+			t.Fatalf("GetBalanceAt failed: %v", err)
+		}
+	}
+
+	node := manager.Nodes[0]
+	if node.LastLatency < 20*time.Millisecond || node.AvgLatency < 20*time.Millisecond {
+		t.Errorf("Expected latencies of at least 20ms, got last %v, average %v", node.LastLatency, node.AvgLatency)
+	}
+	if info := manager.ListNodes()[0]; info.AvgLatencyMs < 20 {
+		t.Errorf("Expected /nodes to report the average latency, got %vms", info.AvgLatencyMs)
+	}
+
+	var metric dto.Metric
+	if err := NodeLatency.WithLabelValues("LatencyNode").(prometheus.Histogram).Write(&metric); err != nil {
+		t.Fatalf("Failed to read histogram: %v", err)
+	}
+	if got := metric.GetHistogram().GetSampleCount(); got != 3 {
+		t.Errorf("Expected 3 latency samples, got %d", got)
+	}
+}
+
+// TestConcurrentHealthChecksShareProbe verifies concurrent checks of one node share a single probe
+func TestConcurrentHealthChecksShareProbe(t *testing.T) {
+	var probes int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&probes, 1)
+		time.Sleep(100 * time.Millisecond) // Keep the probe in flight while the other checks arrive.
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"Geth/v1.13.0"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := NewClientManager([]NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	node := manager.Nodes[0]
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			manager.CheckNodeHealth(node)
+		}()
+		go func() {
+			defer wg.Done()
+			manager.CheckAllNodes(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&probes); got != 1 {
+		t.Errorf("Expected a single upstream probe, got %d", got)
+	}
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if !node.Healthy || node.ErrorCount != 0 {
+		t.Errorf("Expected the node to be healthy with no errors, got healthy=%v errors=%d", node.Healthy, node.ErrorCount)
+	}
+}
+
+// TestGetBalanceFailureGraceWindow verifies a single failed request does not demote a node
+func TestGetBalanceFailureGraceWindow(t *testing.T) {
+	var calls int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1234"}`))
+	}))
+	defer mockServer.Close()
+
+	setEnv(t, "REQUEST_FAILURE_THRESHOLD", "2")
+	defer unsetEnv(t, "REQUEST_FAILURE_THRESHOLD")
+
+	manager := NewClientManager([]NodeConfig{{Name: "FlakyNode", URL: mockServer.URL}}, &http.Client{})
+
+	balance, err := manager.GetBalance("0x00a3Ac5E156B4B291ceB59D019121beB6508d93D")
+	if err != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+	if balance != "0x1234" {
+		t.Errorf("Expected balance 0x1234, got %s", balance)
+	}
+	if !manager.Nodes[0].Healthy {
+		t.Errorf("Expected FlakyNode to stay healthy after a single failure")
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Expected 2 upstream calls, got %d", got)
+	}
+}
+
+// TestGetBalancePerAddressTTL verifies CACHE_TTL_OVERRIDES keeps cold addresses cached past the default TTL
+func TestGetBalancePerAddressTTL(t *testing.T) {
+	const (
+		hotAddress  = "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+		coldAddress = "0x742d35Cc6634C0532925a3b844Bc454e4438f44e"
+	)
+
+	var calls sync.Map
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload jsonRPCPayload
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		count, _ := calls.LoadOrStore(payload.Params[0], new(int32))
+		atomic.AddInt32(count.(*int32), 1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer mockServer.Close()
+
+	setEnv(t, "CACHE_EXPIRATION_SECONDS", "1")
+	defer unsetEnv(t, "CACHE_EXPIRATION_SECONDS")
+	setEnv(t, "CACHE_TTL_OVERRIDES", strings.ToLower(coldAddress)+"=3600")
+	defer unsetEnv(t, "CACHE_TTL_OVERRIDES")
+
+	manager := NewClientManager([]NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+
+	for _, address := range []string{hotAddress, coldAddress} {
+		if _, err := manager.GetBalance(address); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	for _, address := range []string{hotAddress, coldAddress} {
+		if _, err := manager.GetBalance(address); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	for address, expected := range map[string]int32{hotAddress: 2, coldAddress: 1} {
+		count, _ := calls.Load(address)
+		if got := atomic.LoadInt32(count.(*int32)); got != expected {
+			t.Errorf("Expected %d upstream calls for %s, got %d", expected, address, got)
+		}
+	}
+}
+
+// TestRemoveNodeDrainsInFlightRequests verifies a removed node finishes its in-flight request first
+func TestRemoveNodeDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	var answered atomic.Value
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		answered.Store(time.Now())
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1234"}`))
+	}))
+	defer slowServer.Close()
+	otherServer := mockEthereumNode(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`, http.StatusOK)
+	defer otherServer.Close()
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "SlowNode", URL: slowServer.URL},
+		{Name: "OtherNode", URL: otherServer.URL},
+	}, &http.Client{})
+
+	type outcome struct {
+		balance string
+		err     error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		balance, err := manager.GetBalance("0x00a3Ac5E156B4B291ceB59D019121beB6508d93D")
+		done <- outcome{balance, err}
+	}()
+	<-started
+
+	if err := manager.RemoveNode(context.Background(), "SlowNode"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	removed := time.Now()
+
+	result := <-done
+	if result.err != nil || result.balance != "0x1234" {
+		t.Fatalf("Expected the in-flight request to complete with 0x1234, got %q, %v", result.balance, result.err)
+	}
+	if answeredAt, _ := answered.Load().(time.Time); answeredAt.IsZero() || answeredAt.After(removed) {
+		t.Errorf("Expected the in-flight request to be answered before the node was removed")
+	}
+	if len(manager.Nodes) != 1 || manager.Nodes[0].Name != "OtherNode" {
+		t.Errorf("Expected only OtherNode to remain, got %d nodes", len(manager.Nodes))
+	}
+	if node := manager.NextNode(); node == nil || node.Name != "OtherNode" {
+		t.Errorf("Expected OtherNode to be selected after removal, got %v", node)
+	}
+
+	if err := manager.RemoveNode(context.Background(), "SlowNode"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("Expected ErrNodeNotFound removing an unknown node, got %v", err)
+	}
+}
+
+// TestRemoveNodeConcurrentRemovals verifies concurrent removals of a draining node all finish with its drain
+func TestRemoveNodeConcurrentRemovals(t *testing.T) {
+	setEnv(t, "DRAIN_TIMEOUT_SECONDS", "5")
+	defer unsetEnv(t, "DRAIN_TIMEOUT_SECONDS")
+
+	manager := NewClientManager([]NodeConfig{{Name: "BusyNode", URL: "http://busy-node"}}, &http.Client{})
+	node := manager.Nodes[0]
+	manager.acquireNode(node)
+
+	const removals = 2
+	done := make(chan error, removals)
+	for i := 0; i < removals; i++ {
+		go func() { done <- manager.RemoveNode(context.Background(), "BusyNode") }()
+	}
+	// Give both removals time to start waiting on the drain.
+	time.Sleep(100 * time.Millisecond)
+	manager.releaseNode(node)
+
+	for i := 0; i < removals; i++ {
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected every removal to finish once the node drained")
+		}
+	}
+}
+
+// TestGetBalanceResultOverallDeadline verifies the retry loop stops as soon as the caller's deadline passes
+func TestGetBalanceResultOverallDeadline(t *testing.T) {
+	var calls int32
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slowServer.Close()
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "SlowNodeA", URL: slowServer.URL},
+		{Name: "SlowNodeB", URL: slowServer.URL},
+	}, &http.Client{})
+	before := counterValue(t, DeadlineExceeded)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := manager.GetBalanceResult(ctx, "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a deadline exceeded error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("Expected the retry loop to exit promptly, took %v", elapsed)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Expected a single attempt, got %d", got)
+	}
+	if got := counterValue(t, DeadlineExceeded) - before; got != 1 {
+		t.Errorf("Expected the deadline counter to increase by 1, got %v", got)
+	}
+	for _, node := range manager.Nodes {
+		if !node.Healthy {
+			t.Errorf("Expected %s to stay healthy after the caller's deadline passed", node.Name)
+		}
+	}
+}
+
+// TestSaveLoadCache verifies a persisted cache is restored into a new manager, minus expired entries
+func TestSaveLoadCache(t *testing.T) {
+	path := t.TempDir() + "/cache.json"
+
+	manager := NewClientManager(nil, &http.Client{})
+	manager.setCached("eth_getBalance", []interface{}{"0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", "latest"}, "0x1", json.RawMessage(`{"result":"0x1"}`), time.Now(), time.Minute, "Node")
+	manager.setCached("eth_getBalance", []interface{}{"0x742d35Cc6634C0532925a3b844Bc454e4438f44e", "latest"}, "0x2", nil, time.Now(), time.Minute, "Node")
+	manager.setCached("eth_getCode", []interface{}{"0x742d35Cc6634C0532925a3b844Bc454e4438f44e", "latest"}, "0x6080", nil, time.Now(), time.Hour, "Node")
+
+	// Age the second entry past its TTL, and the code entry past the default balance TTL only.
+	for method, age := range map[string]time.Duration{"eth_getBalance": 2 * time.Minute, "eth_getCode": 30 * time.Minute} {
+		key, _ := cacheKey(method, []interface{}{"0x742d35Cc6634C0532925a3b844Bc454e4438f44e", "latest"})
+		aged := manager.Cache[key]
+		aged.Timestamp = time.Now().Add(-age)
+		manager.Cache[key] = aged
+	}
+
+	if err := manager.SaveCache(path); err != nil {
+		t.Fatalf("Expected no error saving the cache, got %v", err)
+	}
+
+	restored := NewClientManager(nil, &http.Client{})
+	if err := restored.LoadCache(path); err != nil {
+		t.Fatalf("Expected no error loading the cache, got %v", err)
+	}
+
+	if len(restored.Cache) != 2 {
+		t.Fatalf("Expected 2 restored entries, got %d", len(restored.Cache))
+	}
+	item, found := restored.getCached("eth_getBalance", []interface{}{"0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", "latest"})
+	if !found || item.Balance != "0x1" || string(item.Raw) != `{"result":"0x1"}` {
+		t.Errorf("Expected the fresh entry to be restored, got %+v (found=%v)", item, found)
+	}
+	item, found = restored.getCached("eth_getCode", []interface{}{"0x742d35Cc6634C0532925a3b844Bc454e4438f44e", "latest"})
+	if !found || item.TTL != time.Hour {
+		t.Errorf("Expected the code entry to be restored with its own TTL, got %+v (found=%v)", item, found)
+	}
+
+	// A missing file leaves the cache cold without failing.
+	if err := NewClientManager(nil, &http.Client{}).LoadCache(path + ".missing"); err != nil {
+		t.Errorf("Expected no error for a missing cache file, got %v", err)
+	}
+}
+
+// TestGlobalCircuitBreaker verifies a provider-wide error rate opens the breaker, which fails fast and then recovers
+func TestGlobalCircuitBreaker(t *testing.T) {
+	var failing int32 = 1
+	var calls int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer mockServer.Close()
+
+	for key, value := range map[string]string{
+		"BREAKER_MIN_REQUESTS":      "4",
+		"BREAKER_OPEN_SECONDS":      "1",
+		"MAX_RETRIES":               "0",
+		"REQUEST_FAILURE_THRESHOLD": "100",
+	} {
+		setEnv(t, key, value)
+		defer unsetEnv(t, key)
+	}
+
+	manager := NewClientManager([]NodeConfig{{Name: "NodeA", URL: mockServer.URL}, {Name: "NodeB", URL: mockServer.URL}}, &http.Client{})
+	address := "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+
+	for i := 0; i < 4; i++ {
+		if _, err := manager.GetBalance(address); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Expected upstream failure %d to reach the nodes, got %v", i+1, err)
+		}
+	}
+
+	before := atomic.LoadInt32(&calls)
+	_, err := manager.GetBalance(address)
+	var circuitErr *CircuitOpenError
+	if !errors.As(err, &circuitErr) || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected the breaker to fail fast, got %v", err)
+	}
+	if circuitErr.RetryAfter <= 0 || circuitErr.RetryAfter > time.Second {
+		t.Errorf("Expected a retry within the 1s open period, got %v", circuitErr.RetryAfter)
+	}
+	if atomic.LoadInt32(&calls) != before {
+		t.Errorf("Expected no upstream call while the breaker is open")
+	}
+	if got := gaugeValue(t, CircuitBreakerState); got != breakerOpen {
+		t.Errorf("Expected breaker state gauge %d, got %v", breakerOpen, got)
+	}
+
+	// Providers recover; after the open period a probe closes the breaker again.
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(1100 * time.Millisecond)
+
+	if balance, err := manager.GetBalance(address); err != nil || balance != "0x1" {
+		t.Fatalf("Expected the probe to succeed, got %q, %v", balance, err)
+	}
+	if got := gaugeValue(t, CircuitBreakerState); got != breakerClosed {
+		t.Errorf("Expected breaker state gauge %d, got %v", breakerClosed, got)
+	}
+}
+
+// gaugeValue returns the current value of a gauge
+func gaugeValue(t *testing.T, gauge prometheus.Gauge) float64 {
+	t.Helper()
+	var metric dto.Metric
+	if err := gauge.Write(&metric); err != nil {
+		t.Fatalf("Failed to read gauge: %v", err)
+	}
+	return metric.GetGauge().GetValue()
+}
+
+// TestIPv6NodeURL verifies a node on a bracketed IPv6 address with a port is probed, queried and listed correctly
+func TestIPv6NodeURL(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	mockServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1234"}`))
+	}))
+	mockServer.Listener = listener
+	mockServer.Start()
+	defer mockServer.Close()
+
+	nodeURL := fmt.Sprintf("http://[::1]:%d/v1/secret-key", listener.Addr().(*net.TCPAddr).Port)
+	if err := ValidateNodeURL(nodeURL); err != nil {
+		t.Fatalf("Expected %s to be valid, got %v", nodeURL, err)
+	}
+
+	manager := NewClientManager([]NodeConfig{{Name: "IPv6Node", URL: nodeURL}}, &http.Client{})
+	if err := manager.checkNodeHealth(context.Background(), manager.Nodes[0]); err != nil {
+		t.Fatalf("Expected the health check to pass, got %v", err)
+	}
+	if balance, err := manager.GetBalance("0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"); err != nil || balance != "0x1234" {
+		t.Fatalf("Expected 0x1234, got %q, %v", balance, err)
+	}
+
+	expectedHost := fmt.Sprintf("[::1]:%d", listener.Addr().(*net.TCPAddr).Port)
+	if nodes := manager.ListNodes(); nodes[0].Host != expectedHost {
+		t.Errorf("Expected host %s, got %s", expectedHost, nodes[0].Host)
+	}
+}
+
+// TestValidateNodeURL verifies malformed node URLs, including unbracketed IPv6 hosts, are rejected
+func TestValidateNodeURL(t *testing.T) {
+	for _, raw := range []string{"http://::1:8545", "localhost:8545", "ftp://node.example.com", "http://"} {
+		if err := ValidateNodeURL(raw); err == nil {
+			t.Errorf("Expected %q to be rejected", raw)
+		}
+	}
+	for _, raw := range []string{"https://mainnet.infura.io/v3/key", "http://10.0.0.5:8545", "http://[2001:db8::1]:8545"} {
+		if err := ValidateNodeURL(raw); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", raw, err)
+		}
+	}
+}
+
+// TestCaptureRateLimitHeaders verifies configured upstream response headers are recorded per node
+func TestCaptureRateLimitHeaders(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "42")
+		w.Header().Set("X-Other", "ignored")
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer mockServer.Close()
+
+	manager := NewClientManager([]NodeConfig{{Name: "LimitedNode", URL: mockServer.URL + "/v2/secret-key"}}, &http.Client{})
+	if _, err := manager.GetBalance("0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	nodes := manager.ListNodes()
+	if len(nodes) != 1 {
+		t.Fatalf("Expected 1 node, got %d", len(nodes))
+	}
+	if got := nodes[0].Headers; len(got) != 1 || got["X-Ratelimit-Remaining"] != "42" {
+		t.Errorf("Expected only X-Ratelimit-Remaining=42 to be captured, got %v", got)
+	}
+	if strings.Contains(nodes[0].Host, "secret-key") {
+		t.Errorf("Expected the node URL path to be hidden, got host %s", nodes[0].Host)
+	}
+	if got := gaugeValue(t, NodeRateLimitRemaining.WithLabelValues("LimitedNode")); got != 42 {
+		t.Errorf("Expected rate-limit gauge 42, got %v", got)
+	}
+}
+
+// TestGetBalanceNoDemoteOnRequestFailure verifies failed user requests leave node health alone when demotion is off
+func TestGetBalanceNoDemoteOnRequestFailure(t *testing.T) {
+	failingServer := mockEthereumNode(`{}`, http.StatusBadGateway)
+	defer failingServer.Close()
+
+	setEnv(t, "DEMOTE_ON_REQUEST_FAILURE", "false")
+	defer unsetEnv(t, "DEMOTE_ON_REQUEST_FAILURE")
+	setEnv(t, "REQUEST_FAILURE_THRESHOLD", "1")
+	defer unsetEnv(t, "REQUEST_FAILURE_THRESHOLD")
+
+	manager := NewClientManager([]NodeConfig{{Name: "FailingNode", URL: failingServer.URL}}, &http.Client{})
+
+	if _, err := manager.GetBalance("0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"); err == nil {
+		t.Fatalf("Expected the request to fail")
+	}
+	if !manager.Nodes[0].Healthy {
+		t.Errorf("Expected FailingNode to stay healthy when DEMOTE_ON_REQUEST_FAILURE=false")
+	}
+}
+
+// TestUpstreamLogSampling verifies UPSTREAM_LOG_SAMPLE_RATE governs how often payloads are logged, with addresses redacted
+func TestUpstreamLogSampling(t *testing.T) {
+	mockServer := mockEthereumNode(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`, http.StatusOK)
+	defer mockServer.Close()
+
+	hook := logtest.NewLocal(utils.Logger)
+	defer hook.Reset()
+	level := utils.Logger.GetLevel()
+	utils.Logger.SetLevel(logrus.DebugLevel)
+	defer utils.Logger.SetLevel(level)
+
+	setEnv(t, "UPSTREAM_LOG_SAMPLE_RATE", "0.5")
+	defer unsetEnv(t, "UPSTREAM_LOG_SAMPLE_RATE")
+
+	manager := NewClientManager([]NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	node := manager.Nodes[0]
+
+	const calls = 400
+	for i := 0; i < calls; i++ {
+		if _, _, err := manager.callNode(context.Background(), node, "eth_getBalance", []interface{}{"0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", "latest"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	sampled := 0
+	for _, entry := range hook.AllEntries() {
+		if entry.Message != "Sampled upstream call" {
+			continue
+		}
+		sampled++
+		if request := entry.Data["request"].(string); strings.Contains(request, "00a3Ac5E") {
+			t.Fatalf("Expected the address to be redacted, got %s", request)
+		}
+	}
+	if sampled < calls*3/10 || sampled > calls*7/10 {
+		t.Errorf("Expected roughly half of %d calls to be sampled, got %d", calls, sampled)
+	}
+}
+
+// TestGetBlockByNumberCacheBounded verifies numbered blocks are cached with a finite TTL and that
+// the oldest are evicted beyond BLOCK_CACHE_MAX_ENTRIES
+func TestGetBlockByNumberCacheBounded(t *testing.T) {
+	setEnv(t, "BLOCK_CACHE_MAX_ENTRIES", "2")
+	defer unsetEnv(t, "BLOCK_CACHE_MAX_ENTRIES")
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload jsonRPCPayload
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload.Method == "eth_blockNumber" {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1000"}`))
+			return
+		}
+		atomic.AddInt32(&calls, 1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"number":"0x1"}}`))
+	}))
+	defer server.Close()
+
+	manager := NewClientManager([]NodeConfig{{Name: "Node", URL: server.URL}}, &http.Client{})
+	for _, number := range []string{"0x1", "0x2", "0x3", "0x3", "0x2"} {
+		if _, err := manager.GetBlockByNumber(context.Background(), number, true); err != nil {
+			t.Fatalf("GetBlockByNumber(%s) failed: %v", number, err)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("Expected the 2 most recent blocks to be served from cache, got %d upstream calls", got)
+	}
+	if len(manager.Cache) != 2 {
+		t.Errorf("Expected the oldest block to be evicted, got %d cache entries", len(manager.Cache))
+	}
+
+	item, found := manager.getCached("eth_getBlockByNumber", []interface{}{"0x3", true})
+	if !found || item.TTL != historicalCacheTTL() {
+		t.Errorf("Expected the block to be cached for the historical TTL, got %+v (found=%v)", item, found)
+	}
+
+	if _, err := manager.GetBlockByNumber(context.Background(), "0x1", true); err != nil {
+		t.Fatalf("GetBlockByNumber(0x1) failed: %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 4 {
+		t.Errorf("Expected the evicted block to be fetched again, got %d upstream calls", got)
+	}
+}
+
+// TestRecentBlockCacheTTL verifies reads at blocks a reorg may still replace, such as a pinned head,
+// get the balance TTL while deeper blocks are cached for the historical TTL
+func TestRecentBlockCacheTTL(t *testing.T) {
+	var head int32 = 0x100
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload jsonRPCPayload
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload.Method == "eth_blockNumber" {
+			_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"0x%x"}`, atomic.LoadInt32(&head))
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer server.Close()
+
+	manager := NewClientManager([]NodeConfig{{Name: "Node", URL: server.URL}}, &http.Client{})
+	address := "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+	balanceTTL := time.Duration(utils.GetEnvInt("CACHE_EXPIRATION_SECONDS", 60)) * time.Second
+
+	for block, expected := range map[string]time.Duration{"0x100": balanceTTL, "0xd0": balanceTTL, "0x90": historicalCacheTTL()} {
+		if _, err := manager.GetBalanceAt(context.Background(), address, block); err != nil {
+			t.Fatalf("GetBalanceAt at %s failed: %v", block, err)
+		}
+		if item, _ := manager.getCached("eth_getBalance", []interface{}{address, block}); item.TTL != expected {
+			t.Errorf("Expected a balance at %s to be cached for %s, got %s", block, expected, item.TTL)
+		}
+	}
+
+	// Once the pinned block is buried, the entry cached near the head still expires on its short TTL.
+	atomic.StoreInt32(&head, 0x164)
+	key, _ := cacheKey("eth_getBalance", []interface{}{address, "0x100"})
+	manager.mu.Lock()
+	item := manager.Cache[key]
+	item.Timestamp = time.Now().Add(-balanceTTL - time.Second)
+	manager.Cache[key] = item
+	manager.mu.Unlock()
+	manager.headCache = sharedValue{}
+
+	result, err := manager.GetBalanceAt(context.Background(), address, "0x100")
+	if err != nil || result.Cached {
+		t.Errorf("Expected the near-head entry to be refetched after its short TTL, got %+v, %v", result, err)
+	}
+}
+
+// TestBlockAtTimestamp verifies a timestamp resolves to the last block mined at or before it
+func TestBlockAtTimestamp(t *testing.T) {
+	// Block n is mined at 1000+12n; the chain is at block 100.
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload jsonRPCPayload
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload.Method == "eth_blockNumber" {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x64"}`))
+			return
+		}
+		number, _ := strconv.ParseInt(strings.TrimPrefix(payload.Params[0].(string), "0x"), 16, 64)
+		_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":{"number":"%s","timestamp":"0x%x"}}`, payload.Params[0], 1000+12*number)
+	}))
+	defer mockServer.Close()
+
+	manager := NewClientManager([]NodeConfig{{Name: "MockNode", URL: mockServer.URL}}, &http.Client{})
+	for timestamp, expected := range map[int64]string{
+		1000:              "0x0",
+		1000 + 12*37:      "0x25",
+		1000 + 12*37 + 11: "0x25",
+		1000 + 12*99 + 1:  "0x63",
+		1000 + 12*100:     "0x64",
+	} {
+		block, err := manager.BlockAtTimestamp(context.Background(), timestamp)
+		if err != nil || block != expected {
+			t.Errorf("Expected block %s at timestamp %d, got %q, %v", expected, timestamp, block, err)
+		}
+	}
+
+	for _, timestamp := range []int64{999, time.Now().Add(time.Hour).Unix()} {
+		if _, err := manager.BlockAtTimestamp(context.Background(), timestamp); !errors.Is(err, ErrInvalidTimestamp) {
+			t.Errorf("Expected ErrInvalidTimestamp at timestamp %d, got %v", timestamp, err)
+		}
+	}
+}
+
+// TestWarmConnections verifies warm-up opens a connection to each node that later requests reuse
+func TestWarmConnections(t *testing.T) {
+	var newConns [2]int32
+	var servers []*httptest.Server
+	for i := range newConns {
+		i := i
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+		}))
+		server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				atomic.AddInt32(&newConns[i], 1)
+			}
+		}
+		server.Start()
+		defer server.Close()
+		servers = append(servers, server)
+	}
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "NodeA", URL: servers[0].URL},
+		{Name: "NodeB", URL: servers[1].URL},
+	}, &http.Client{Transport: &http.Transport{}})
+
+	if warmed := manager.WarmConnections(5 * time.Second); warmed != 2 {
+		t.Fatalf("Expected both nodes to be warmed, got %d", warmed)
+	}
+	for i := range newConns {
+		if got := atomic.LoadInt32(&newConns[i]); got != 1 {
+			t.Errorf("Expected node %d to receive one connection during warm-up, got %d", i, got)
+		}
+	}
+
+	// Requests after warm-up reuse the pooled connections.
+	for i := 0; i < 2; i++ {
+		if _, err := manager.GetBalance(fmt.Sprintf("0x%040d", i)); err != nil {
+			t.Fatalf("Expected balance lookup to succeed, got %v", err)
+		}
+	}
+	for i := range newConns {
+		if got := atomic.LoadInt32(&newConns[i]); got != 1 {
+			t.Errorf("Expected node %d to reuse its warmed connection, got %d connections", i, got)
+		}
+	}
+}
+
+// TestStuckNodeQuarantined verifies a node whose block height stops advancing while a peer's does is marked unhealthy
+func TestStuckNodeQuarantined(t *testing.T) {
+	setEnv(t, "STUCK_NODE_CHECKS", "2")
+	defer unsetEnv(t, "STUCK_NODE_CHECKS")
+
+	node := func(height func() int64) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var payload jsonRPCPayload
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			if payload.Method == "eth_blockNumber" {
+				_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"0x%x"}`, height())
+				return
+			}
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"Geth/v1.13.0"}`))
+		}))
+	}
+	var advancing, stuck int64 = 100, 100
+	stuckNode := node(func() int64 { return atomic.LoadInt64(&stuck) })
+	defer stuckNode.Close()
+	advancingNode := node(func() int64 { return atomic.AddInt64(&advancing, 1) })
+	defer advancingNode.Close()
+
+	manager := NewClientManager([]NodeConfig{
+		{Name: "StuckNode", URL: stuckNode.URL},
+		{Name: "AdvancingNode", URL: advancingNode.URL},
+	}, &http.Client{})
+
+	for i := 0; i < 2; i++ {
+		manager.CheckAllNodes(context.Background())
+		if !manager.Nodes[0].Healthy {
+			t.Fatalf("Expected the node to stay healthy before %d stalled checks, failed at check %d", 2, i+1)
+		}
+	}
+
+	statuses := manager.CheckAllNodes(context.Background())
+	if manager.Nodes[0].Healthy || !strings.Contains(statuses[0].Error, ErrNodeStuck.Error()) {
+		t.Errorf("Expected the stuck node to be quarantined, got %+v", statuses[0])
+	}
+	if !manager.Nodes[1].Healthy {
+		t.Errorf("Expected the advancing node to stay healthy, got %+v", statuses[1])
+	}
+
+	// The quarantine outlasts the cooldown and only ends once the height moves.
+	manager.cooldownNode(manager.Nodes[0], 0)
+	if manager.Nodes[0].Healthy {
+		t.Errorf("Expected the stuck node to stay quarantined after the cooldown")
+	}
+	atomic.StoreInt64(&stuck, 1000)
+	if manager.CheckAllNodes(context.Background()); !manager.Nodes[0].Healthy {
+		t.Errorf("Expected the node to recover once its height moved")
+	}
+
+	// A peer that is down does not count as ahead, whatever height it last reported.
+	manager.mu.Lock()
+	manager.Nodes[1].Healthy = false
+	manager.Nodes[1].blockHeight = 5000
+	manager.mu.Unlock()
+	for i := 0; i < 3; i++ {
+		_ = manager.checkNodeHealth(context.Background(), manager.Nodes[0])
+	}
+	if !manager.Nodes[0].Healthy {
+		t.Errorf("Expected a node behind only unhealthy peers not to be quarantined")
+	}
+}
@@ -0,0 +1,24 @@
+package nodemanager
+
+import (
+	"context"
+	"github.com/luishsr/eth-proxy/utils"
+	"time"
+)
+
+// GetCode returns the bytecode deployed at address as of block; "0x" means an externally owned
+// account. Deployed code rarely changes, so results (other than pending ones) are cached for
+// CODE_CACHE_EXPIRATION_SECONDS, a day by default.
+func (m *ClientManager) GetCode(ctx context.Context, address string, block string) (string, error) {
+	if err := validateBlock(block); err != nil {
+		return "", err
+	}
+
+	ttl := time.Duration(utils.GetEnvInt("CODE_CACHE_EXPIRATION_SECONDS", 86400)) * time.Second
+	if block == "pending" {
+		ttl = 0
+	}
+
+	ctx = forBlock(ctx, block)
+	return m.cachedCall(ctx, "eth_getCode", []interface{}{address, block}, ttl, parseData)
+}
@@ -0,0 +1,89 @@
+package nodemanager
+
+import (
+	"context"
+	"github.com/luishsr/eth-proxy/utils"
+	"sync"
+	"time"
+)
+
+// NodeBalance is the balance a single node reported for an address.
+type NodeBalance struct {
+	Node    string `json:"node"`
+	Balance string `json:"balance,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// GetBalanceAllNodes queries every healthy node concurrently for the address's balance, bypassing
+// the cache, so discrepancies between providers can be surfaced.
+func (m *ClientManager) GetBalanceAllNodes(ctx context.Context, address string) []NodeBalance {
+	m.mu.Lock()
+	var nodes []*EthereumNode
+	for _, node := range m.Nodes {
+		if node.Healthy {
+			nodes = append(nodes, node)
+		}
+	}
+	m.mu.Unlock()
+
+	timeout := time.Duration(utils.GetEnvInt("NODE_REQUEST_TIMEOUT_SECONDS", 5)) * time.Second
+	balances := make([]NodeBalance, len(nodes))
+	var wg sync.WaitGroup
+
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *EthereumNode) {
+			defer wg.Done()
+
+			attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			balances[i] = NodeBalance{Node: node.Name}
+			balance, _, err := m.fetchBalanceFromNode(attemptCtx, node, address, "latest")
+			if err != nil {
+				balances[i].Error = err.Error()
+				return
+			}
+			balances[i].Balance = balance
+		}(i, node)
+	}
+
+	wg.Wait()
+	return balances
+}
+
+// BalancesAgree reports whether every node that answered returned the same balance.
+// It is false when no node answered.
+func BalancesAgree(balances []NodeBalance) bool {
+	agreed := ""
+	for _, b := range balances {
+		if b.Error != "" {
+			continue
+		}
+		if agreed == "" {
+			agreed = b.Balance
+		} else if b.Balance != agreed {
+			return false
+		}
+	}
+	return agreed != ""
+}
+
+// MajorityBalance returns the balance reported by more than half of the nodes that answered,
+// reporting false when no balance has such a majority.
+func MajorityBalance(balances []NodeBalance) (string, bool) {
+	counts := make(map[string]int)
+	answered := 0
+	for _, b := range balances {
+		if b.Error == "" {
+			counts[b.Balance]++
+			answered++
+		}
+	}
+	for balance, count := range counts {
+		if count*2 > answered {
+			return balance, true
+		}
+	}
+	return "", false
+}
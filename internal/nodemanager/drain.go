@@ -0,0 +1,96 @@
+package nodemanager
+
+import (
+	"context"
+	"errors"
+	"github.com/luishsr/eth-proxy/utils"
+	"time"
+)
+
+// ErrNodeNotFound is returned when no configured node has the requested name.
+var ErrNodeNotFound = errors.New("node not found")
+
+// RemoveNode removes the named node in two phases: it first marks the node draining so it receives
+// no new requests, then waits for its in-flight requests to finish (for at most
+// DRAIN_TIMEOUT_SECONDS, 30 by default, or until ctx is done) before dropping it.
+func (m *ClientManager) RemoveNode(ctx context.Context, name string) error {
+	m.mu.Lock()
+	var node *EthereumNode
+	for _, n := range m.Nodes {
+		if n.Name == name {
+			node = n
+			break
+		}
+	}
+	if node == nil {
+		m.mu.Unlock()
+		return ErrNodeNotFound
+	}
+
+	node.Draining = true
+	m.updateNodeGauges()
+	// A concurrent removal already draining the node shares its drained channel.
+	drained := node.drained
+	if drained == nil && node.inFlight > 0 {
+		drained = make(chan struct{})
+		node.drained = drained
+	}
+	m.mu.Unlock()
+
+	if drained != nil {
+		utils.Logger.WithField("node", name).Info("Draining Ethereum Node before removal")
+
+		timeout := time.NewTimer(time.Duration(utils.GetEnvInt("DRAIN_TIMEOUT_SECONDS", 30)) * time.Second)
+		defer timeout.Stop()
+
+		select {
+		case <-drained:
+		case <-timeout.C:
+			utils.Logger.WithField("node", name).Warn("Drain timed out, removing Ethereum Node with requests in flight")
+		case <-ctx.Done():
+			utils.Logger.WithField("node", name).Warn("Drain cancelled, removing Ethereum Node with requests in flight")
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, n := range m.Nodes {
+		if n != node {
+			continue
+		}
+		m.Nodes = append(m.Nodes[:i:i], m.Nodes[i+1:]...)
+		// Keep the round-robin cursor pointing at the same next node.
+		if i < m.index {
+			m.index--
+		}
+		if m.index >= len(m.Nodes) {
+			m.index = 0
+		}
+		break
+	}
+	node.removed = true
+	m.updateNodeGauges()
+
+	utils.Logger.WithField("node", name).Info("Ethereum Node removed")
+	return nil
+}
+
+// acquireNode records a request starting on node.
+func (m *ClientManager) acquireNode(node *EthereumNode) {
+	m.mu.Lock()
+	node.inFlight++
+	m.mu.Unlock()
+}
+
+// releaseNode records a request on node finishing, completing its drain when it was the last one.
+func (m *ClientManager) releaseNode(node *EthereumNode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node.inFlight--
+	if node.inFlight == 0 && node.drained != nil {
+		close(node.drained)
+		node.drained = nil
+	}
+}
@@ -0,0 +1,79 @@
+package nodemanager
+
+import (
+	"errors"
+	"fmt"
+	"github.com/luishsr/eth-proxy/utils"
+	"strconv"
+	"strings"
+)
+
+// ErrResponseTooLarge is returned when a node's response body exceeds MAX_UPSTREAM_RESPONSE_BYTES.
+var ErrResponseTooLarge = errors.New("upstream response exceeds size limit")
+
+// ErrInvalidQuantity is returned when a node's result is not a hex or decimal integer.
+var ErrInvalidQuantity = errors.New("non-numeric result from node")
+
+// ErrNullResult is returned when a node answers a lookup with a null or missing result, as some
+// providers do for queries they cannot serve, instead of a JSON-RPC error.
+var ErrNullResult = errors.New("null result from node")
+
+// ErrInvalidUpstreamResponse is returned when a node's response body is not valid JSON-RPC.
+var ErrInvalidUpstreamResponse = errors.New("invalid upstream response")
+
+// defaultRetriableRPCCodes are retried on another node when RETRIABLE_RPC_CODES is unset:
+// -32603 (internal error) and -32005 (limit exceeded).
+const defaultRetriableRPCCodes = "-32603,-32005"
+
+// RPCError is a JSON-RPC error object returned by a node.
+type RPCError struct {
+	Code    int
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("error response from node: %s", e.Message)
+}
+
+// AttemptError records why a single upstream attempt failed.
+type AttemptError struct {
+	Node  string `json:"node"`
+	Error string `json:"error"`
+}
+
+// RetriesExhaustedError is returned when every attempt of a lookup failed. It keeps each attempt's
+// failure for diagnostics and unwraps to the last one.
+type RetriesExhaustedError struct {
+	Description string
+	Retries     int
+	Attempts    []AttemptError
+	Last        error
+}
+
+func (e *RetriesExhaustedError) Error() string {
+	return fmt.Sprintf("failed to fetch %s after %d retries, last error: %v", e.Description, e.Retries, e.Last)
+}
+
+func (e *RetriesExhaustedError) Unwrap() error {
+	return e.Last
+}
+
+// isRetriableRPCCode reports whether a JSON-RPC error code is listed in RETRIABLE_RPC_CODES.
+func isRetriableRPCCode(code int) bool {
+	raw := utils.GetEnv("RETRIABLE_RPC_CODES")
+	if raw == "" {
+		raw = defaultRetriableRPCCodes
+	}
+
+	for _, entry := range strings.Split(raw, ",") {
+		retriable, err := strconv.Atoi(strings.TrimSpace(entry))
+		if err != nil {
+			utils.Logger.WithField("entry", entry).Warn("Ignoring invalid RETRIABLE_RPC_CODES entry")
+			continue
+		}
+		if retriable == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package nodemanager
+
+import (
+	"github.com/luishsr/eth-proxy/utils"
+	"time"
+)
+
+// fairRoundMaxAge returns how long a fairness round lasts, from ROUND_ROBIN_MAX_AGE_SECONDS. Zero
+// (the default) disables fair selection, leaving plain round-robin.
+func fairRoundMaxAge() time.Duration {
+	return time.Duration(utils.GetEnvInt("ROUND_ROBIN_MAX_AGE_SECONDS", 0)) * time.Second
+}
+
+// leastSelected returns the eligible node selected least often in the current fairness round and
+// its index, scanning from m.index so ties keep round-robin order; nil if no node is eligible.
+// Plain round-robin hands the turn of a skipped node to its successor, so health flapping skews
+// traffic; picking the least-selected node lets a recovered node catch up with its peers. Rounds
+// restart after maxAge so that, after a long outage, a node only catches up on recent traffic.
+// Callers must hold m.mu.
+func (m *ClientManager) leastSelected(eligible func(*EthereumNode) bool, maxAge time.Duration, now time.Time) (int, *EthereumNode) {
+	if m.roundCounts == nil || now.Sub(m.roundStarted) >= maxAge {
+		m.roundCounts = make(map[string]int)
+		m.roundStarted = now
+	}
+
+	best := -1
+	for offset := 0; offset < len(m.Nodes); offset++ {
+		i := (m.index + offset) % len(m.Nodes)
+		if !eligible(m.Nodes[i]) {
+			continue
+		}
+		if best == -1 || m.roundCounts[m.Nodes[i].Name] < m.roundCounts[m.Nodes[best].Name] {
+			best = i
+		}
+	}
+	if best == -1 {
+		return 0, nil
+	}
+	return best, m.Nodes[best]
+}
@@ -0,0 +1,44 @@
+package nodemanager
+
+import (
+	"context"
+	"github.com/luishsr/eth-proxy/utils"
+	"math/big"
+	"time"
+)
+
+// EstimateGas returns the node's eth_estimateGas estimate for the transaction call object tx.
+func (m *ClientManager) EstimateGas(ctx context.Context, tx map[string]interface{}) (*big.Int, error) {
+	result, err := m.Call(ctx, "eth_estimateGas", []interface{}{tx})
+	if err != nil {
+		return nil, err
+	}
+
+	quantity, err := parseQuantity(result)
+	if err != nil {
+		return nil, err
+	}
+
+	gas, _ := new(big.Int).SetString(quantity[2:], 16)
+	return gas, nil
+}
+
+// GasPrice returns the node's eth_gasPrice as a 0x-prefixed hex quantity in wei. The price moves
+// with every block, so it is shared across requests and cached for GAS_PRICE_CACHE_SECONDS
+// (5 by default), with at most one refresh upstream per cache window.
+func (m *ClientManager) GasPrice(ctx context.Context) (string, error) {
+	ttl := time.Duration(utils.GetEnvInt("GAS_PRICE_CACHE_SECONDS", 5)) * time.Second
+
+	price, err := m.gasPriceCache.get(ctx, ttl, func(ctx context.Context) (interface{}, error) {
+		result, err := m.Call(ctx, "eth_gasPrice", []interface{}{})
+		if err != nil {
+			return nil, err
+		}
+		return parseQuantity(result)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return price.(string), nil
+}
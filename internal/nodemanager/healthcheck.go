@@ -0,0 +1,278 @@
+package nodemanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/luishsr/eth-proxy/utils"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HealthCheckPayload is the JSON-RPC method and params used to probe a node's health.
+type HealthCheckPayload struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// NodeStatus is a point-in-time view of a node's health.
+type NodeStatus struct {
+	Name       string `json:"name"`
+	Healthy    bool   `json:"healthy"`
+	ErrorCount int    `json:"errorCount"`
+	Error      string `json:"error,omitempty"`
+}
+
+// defaultHealthCheck is the probe used for nodes without a custom health-check payload.
+var defaultHealthCheck = HealthCheckPayload{Method: "web3_clientVersion", Params: []interface{}{}}
+
+// defaultFunctionalCheckAddress is the address queried by functional health checks when
+// FUNCTIONAL_HEALTHCHECK_ADDRESS is unset.
+const defaultFunctionalCheckAddress = "0x0000000000000000000000000000000000000000"
+
+// ParseHealthCheckPayload decodes and validates a JSON health-check payload template,
+// e.g. {"method":"eth_chainId","params":[]}.
+func ParseHealthCheckPayload(raw string) (*HealthCheckPayload, error) {
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.DisallowUnknownFields()
+
+	var payload HealthCheckPayload
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid health-check payload: %w", err)
+	}
+	if strings.TrimSpace(payload.Method) == "" {
+		return nil, fmt.Errorf("invalid health-check payload: method is required")
+	}
+	if payload.Params == nil {
+		payload.Params = []interface{}{}
+	}
+
+	return &payload, nil
+}
+
+// functionalCheckAddress returns the address whose balance functional checks fetch.
+func functionalCheckAddress() string {
+	if address := os.Getenv("FUNCTIONAL_HEALTHCHECK_ADDRESS"); address != "" {
+		return address
+	}
+	return defaultFunctionalCheckAddress
+}
+
+// CheckNodeHealth performs a health check on the specified node using its configured probe.
+func (m *ClientManager) CheckNodeHealth(node *EthereumNode) {
+	_ = m.checkNodeHealth(context.Background(), node)
+}
+
+// healthCheckRun is a health check in progress, shared by every caller checking the same node.
+type healthCheckRun struct {
+	done chan struct{} // Closed once the check completes.
+	err  error         // Outcome of the check, set before done is closed.
+}
+
+// checkNodeHealth probes the node, records the outcome on it and returns the probe error, if any.
+// Checks of the same node are serialized: a caller arriving while one is in flight (e.g. a manual
+// recheck racing the periodic checker) waits for it and shares its outcome instead of probing again.
+func (m *ClientManager) checkNodeHealth(ctx context.Context, node *EthereumNode) error {
+	m.mu.Lock()
+	if run := node.healthCheck; run != nil {
+		m.mu.Unlock()
+		select {
+		case <-run.done:
+			return run.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	run := &healthCheckRun{done: make(chan struct{})}
+	node.healthCheck = run
+	m.mu.Unlock()
+
+	run.err = m.probeNodeHealth(ctx, node)
+
+	m.mu.Lock()
+	node.healthCheck = nil
+	m.mu.Unlock()
+	close(run.done)
+	return run.err
+}
+
+// probeNodeHealth runs a single health check of the node; see checkNodeHealth.
+func (m *ClientManager) probeNodeHealth(ctx context.Context, node *EthereumNode) error {
+	probe := node.HealthCheck
+	if probe.Method == "" {
+		probe = defaultHealthCheck
+	}
+
+	payload := jsonRPCPayload{
+		JSONRPC: "2.0",
+		Method:  probe.Method,
+		Params:  probe.Params,
+		ID:      1,
+	}
+
+	req, err := newRPCRequest(ctx, node, payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.clientFor(node).Do(req)
+
+	utils.Logger.Info("Health-checking Node: " + node.Name)
+
+	statusCode := 0
+	if err == nil {
+		statusCode = resp.StatusCode
+		// Drain the (small) probe response so the connection returns to the pool for reuse.
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, int64(utils.GetEnvInt("MAX_UPSTREAM_RESPONSE_BYTES", defaultMaxUpstreamResponseBytes))))
+		_ = resp.Body.Close()
+		if statusCode != http.StatusOK {
+			err = fmt.Errorf("unexpected status code: %d", statusCode)
+		}
+	}
+
+	// Providers may gate methods differently, so a live node is not necessarily able to serve
+	// balances. FUNCTIONAL_HEALTHCHECK=true also fetches a known balance, at the cost of quota.
+	functional := err == nil && utils.GetEnvBool("FUNCTIONAL_HEALTHCHECK", false)
+	var functionalErr error
+	if functional {
+		if _, _, functionalErr = m.fetchBalanceFromNode(ctx, node, functionalCheckAddress(), "latest"); functionalErr != nil {
+			err = fmt.Errorf("functional health check failed: %w", functionalErr)
+		}
+	}
+
+	// A node stuck at a block while its peers advance serves confidently wrong data.
+	// STUCK_NODE_CHECKS=N also tracks block heights, quarantining a node whose height has not
+	// advanced in N consecutive checks while a peer is ahead.
+	stuckChecks := utils.GetEnvInt("STUCK_NODE_CHECKS", 0)
+	trackHeight := err == nil && stuckChecks > 0
+	var height uint64
+	if trackHeight {
+		var heightErr error
+		if height, heightErr = m.nodeBlockHeight(ctx, node); heightErr != nil {
+			err = fmt.Errorf("block height check failed: %w", heightErr)
+			trackHeight = false
+		}
+	}
+
+	// A probe cut short by the caller says nothing about the node, so leave its state alone.
+	if ctx.Err() != nil {
+		if err == nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if functional {
+		passed := functionalErr == nil
+		node.FunctionalHealthy = &passed
+	}
+	if trackHeight && m.recordBlockHeight(node, height, stuckChecks) {
+		err = ErrNodeStuck
+	}
+
+	if err != nil {
+		node.Healthy = false
+		node.ErrorCount++
+		if node.ErrorCount >= 3 {
+			go m.cooldownNode(node, 1*time.Minute)
+		}
+
+		utils.Logger.Info("*** Node " + node.Name + " is not running!")
+
+		utils.Logger.WithFields(logrus.Fields{
+			"node":        node.Name,
+			"status_code": statusCode,
+			"error":       err,
+		}).Println("Ethereum Node health check failed")
+	} else {
+		utils.Logger.Info("Node " + node.Name + " is up and running!")
+		node.Healthy = true
+		node.ErrorCount = 0
+	}
+	m.updateNodeGauges()
+
+	return err
+}
+
+// CheckAllNodes probes every node concurrently, bounded by HEALTHCHECK_CONCURRENCY,
+// and returns their resulting statuses in configuration order.
+func (m *ClientManager) CheckAllNodes(ctx context.Context) []NodeStatus {
+	m.mu.Lock()
+	nodes := make([]*EthereumNode, len(m.Nodes))
+	copy(nodes, m.Nodes)
+	m.mu.Unlock()
+
+	statuses := make([]NodeStatus, len(nodes))
+	semaphore := make(chan struct{}, utils.GetEnvInt("HEALTHCHECK_CONCURRENCY", 8))
+	var wg sync.WaitGroup
+
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *EthereumNode) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			err := m.checkNodeHealth(ctx, node)
+
+			m.mu.Lock()
+			statuses[i] = NodeStatus{Name: node.Name, Healthy: node.Healthy, ErrorCount: node.ErrorCount}
+			m.mu.Unlock()
+			if err != nil {
+				statuses[i].Error = err.Error()
+			}
+		}(i, node)
+	}
+
+	wg.Wait()
+	return statuses
+}
+
+// cooldownNode temporarily marks a node as unhealthy before rechecking its health. A stuck node
+// stays quarantined until a health check sees its block height move.
+func (m *ClientManager) cooldownNode(node *EthereumNode, duration time.Duration) {
+	time.Sleep(duration) // Wait for the cooldown period
+
+	m.mu.Lock()
+	if node.stuck {
+		m.mu.Unlock()
+		utils.Logger.WithField("node", node.Name).Warn("Ethereum Node cooldown period ended, keeping stuck node quarantined")
+		return
+	}
+	node.Healthy = true // Assume the node might be healthy now
+	node.ErrorCount = 0 // Reset error count
+	m.updateNodeGauges()
+	m.mu.Unlock()
+
+	utils.Logger.WithField("node", node.Name).Warn("Ethereum Node cooldown period ended, marking as healthy")
+}
+
+// StartHealthChecks begins periodic health checks for each node.
+func (m *ClientManager) StartHealthChecks(interval time.Duration) {
+	utils.Logger.Info("Ethereum Nodes periodic health check started")
+	for _, node := range m.Nodes {
+		go func(n *EthereumNode) {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				m.mu.Lock()
+				removed := n.removed
+				m.mu.Unlock()
+				if removed {
+					return
+				}
+
+				m.CheckNodeHealth(n)
+			}
+		}(node)
+	}
+}
@@ -1,7 +1,36 @@
 package nodemanager
 
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+)
+
 type ClientManagerInterface interface {
 	GetBalance(address string) (string, error)
+	GetBalanceAtBlock(address string, blockTag string) (string, error)
+	GetBalanceResult(ctx context.Context, address string) (*BalanceResult, error)
+	GetBalanceAt(ctx context.Context, address string, block string) (*BalanceResult, error)
+	BlockNumber(ctx context.Context) (string, error)
+	BlockAtTimestamp(ctx context.Context, timestamp int64) (string, error)
 	GetNodeName() string
 	IsReady() bool
+	CheckAllNodes(ctx context.Context) []NodeStatus
+	GetBalanceAllNodes(ctx context.Context, address string) []NodeBalance
+	CachedBalance(address string) (string, bool)
+	GetBalances(ctx context.Context, addresses []string) []AddressBalance
+	StreamBalances(ctx context.Context, addresses []string) <-chan AddressBalance
+	SelectionStats() []NodeSelectionShare
+	GetEthUsdPrice(ctx context.Context) (*big.Rat, error)
+	RemoveNode(ctx context.Context, name string) error
+	ListNodes() []NodeInfo
+	EstimateGas(ctx context.Context, tx map[string]interface{}) (*big.Int, error)
+	GetCode(ctx context.Context, address string, block string) (string, error)
+	GetStorageAt(ctx context.Context, address string, slot string, block string) (string, error)
+	GasPrice(ctx context.Context) (string, error)
+	GetTransactionCount(ctx context.Context, address string, block string) (string, error)
+	GetTokenBalance(ctx context.Context, token string, holder string, block string) (string, error)
+	GetBlockByNumber(ctx context.Context, number string, full bool) (json.RawMessage, error)
+	OldestCacheEntries(n int) []CacheEntryAge
+	RefreshOldestCacheEntries(ctx context.Context, n int) []CacheRefresh
 }
@@ -0,0 +1,22 @@
+package nodemanager
+
+import "time"
+
+// latencyWeight is the weight of the newest sample in a node's AvgLatency.
+const latencyWeight = 0.2
+
+// recordLatency records the round trip of a successful balance fetch from node, updating its
+// LastLatency and AvgLatency and the NodeLatency histogram.
+func (m *ClientManager) recordLatency(node *EthereumNode, latency time.Duration) {
+	NodeLatency.WithLabelValues(node.Name).Observe(latency.Seconds())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node.LastLatency = latency
+	if node.AvgLatency == 0 {
+		node.AvgLatency = latency
+	} else {
+		node.AvgLatency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(node.AvgLatency))
+	}
+}
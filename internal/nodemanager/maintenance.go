@@ -0,0 +1,74 @@
+package nodemanager
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindow is a daily UTC time range during which a node gets no requests. A window
+// whose end is before its start spans midnight.
+type MaintenanceWindow struct {
+	Start time.Duration // Offset from UTC midnight.
+	End   time.Duration // Offset from UTC midnight, exclusive.
+}
+
+// ParseMaintenanceWindows parses comma-separated daily UTC ranges such as "02:00-03:00,23:30-00:15".
+func ParseMaintenanceWindows(raw string) ([]MaintenanceWindow, error) {
+	var windows []MaintenanceWindow
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		start, end, found := strings.Cut(entry, "-")
+		if !found {
+			return nil, fmt.Errorf("invalid maintenance window %q: expected HH:MM-HH:MM", entry)
+		}
+		startOffset, err := parseTimeOfDay(start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %q: %w", entry, err)
+		}
+		endOffset, err := parseTimeOfDay(end)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %q: %w", entry, err)
+		}
+		windows = append(windows, MaintenanceWindow{Start: startOffset, End: endOffset})
+	}
+	return windows, nil
+}
+
+// parseTimeOfDay parses "HH:MM" into an offset from midnight.
+func parseTimeOfDay(raw string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(raw))
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", raw)
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// contains reports whether t falls within the window.
+func (w MaintenanceWindow) contains(t time.Time) bool {
+	t = t.UTC()
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// inMaintenance reports whether the node is within one of its maintenance windows at t.
+func (n *EthereumNode) inMaintenance(t time.Time) bool {
+	for _, window := range n.Maintenance {
+		if window.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectable reports whether the node may be picked for a request at t: it is healthy, not
+// draining and outside its maintenance windows. Callers must hold ClientManager.mu.
+func (n *EthereumNode) selectable(t time.Time) bool {
+	return n.Healthy && !n.Draining && !n.inMaintenance(t)
+}
@@ -0,0 +1,84 @@
+package nodemanager
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	// UpstreamDecodeErrors counts node responses whose body could not be decoded as JSON-RPC.
+	UpstreamDecodeErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "eth_proxy_upstream_decode_errors_total",
+			Help: "Total number of upstream responses that failed JSON decoding, per Ethereum node",
+		},
+		[]string{"node"},
+	)
+
+	// DeadlineExceeded counts lookups abandoned because the caller's overall deadline passed mid-retry.
+	DeadlineExceeded = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "eth_proxy_deadline_exceeded_total",
+			Help: "Total number of upstream lookups that ran out of their overall deadline across retries",
+		},
+	)
+
+	// UpstreamStale is 1 while balances are being served from cache without any successful upstream
+	// balance fetch in the last UPSTREAM_STALE_SECONDS.
+	UpstreamStale = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "eth_proxy_upstream_stale",
+			Help: "Whether balances are only being served from cache because upstream fetches stopped succeeding (1) or not (0)",
+		},
+	)
+
+	// NodesConfigured is the number of nodes the proxy is configured with.
+	NodesConfigured = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "eth_proxy_nodes_configured",
+			Help: "Number of configured Ethereum nodes",
+		},
+	)
+
+	// NodesHealthy is the number of nodes currently eligible for requests (healthy and not draining).
+	NodesHealthy = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "eth_proxy_nodes_healthy",
+			Help: "Number of healthy Ethereum nodes that are not draining",
+		},
+	)
+
+	// CircuitBreakerState reports the global circuit breaker: 0 closed, 1 open, 2 half-open.
+	CircuitBreakerState = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "eth_proxy_circuit_breaker_state",
+			Help: "State of the global circuit breaker across all Ethereum nodes (0 closed, 1 open, 2 half-open)",
+		},
+	)
+
+	// NodeRateLimitRemaining reports the latest rate-limit allowance each node advertised in its response headers.
+	NodeRateLimitRemaining = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "eth_proxy_node_rate_limit_remaining",
+			Help: "Remaining upstream rate-limit allowance reported by each Ethereum node",
+		},
+		[]string{"node"},
+	)
+
+	// NodeThrottleWait records how long requests waited for a node's client-side rate limit.
+	NodeThrottleWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "eth_proxy_node_throttle_wait_seconds",
+			Help:    "Time requests waited for an Ethereum node's client-side rate limit before being sent",
+			Buckets: []float64{0, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+		},
+		[]string{"node"},
+	)
+
+	// NodeLatency tracks the round trip of successful balance fetches per node.
+	NodeLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "eth_proxy_node_latency_seconds",
+			Help:    "Round-trip latency of successful balance fetches, per Ethereum node",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"node"},
+	)
+)
@@ -0,0 +1,131 @@
+package nodemanager
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCapturedHeaders are the upstream response headers recorded when CAPTURE_RESPONSE_HEADERS is unset.
+const defaultCapturedHeaders = "X-RateLimit-Remaining,X-RateLimit-Reset"
+
+// NodeInfo describes a configured node for the /nodes endpoint. The URL is reduced to its host
+// because provider URLs often embed API keys.
+type NodeInfo struct {
+	Name         string            `json:"name"`
+	Host         string            `json:"host"`
+	Region       string            `json:"region,omitempty"`
+	Archive      bool              `json:"archive,omitempty"`
+	Healthy      bool              `json:"healthy"`
+	Draining     bool              `json:"draining"`
+	ErrorCount   int               `json:"errorCount"`
+	Functional   *bool             `json:"functional,omitempty"`   // Latest functional health-check outcome, if enabled.
+	AvgLatencyMs float64           `json:"avgLatencyMs,omitempty"` // Moving average of successful balance fetch latency.
+	Headers      map[string]string `json:"headers,omitempty"`      // Latest values of the captured response headers.
+}
+
+// ValidateNodeURL checks that raw is an absolute http(s) URL with a host, so misconfigured node
+// URLs fail at startup rather than on every request. IPv6 hosts must be bracketed, as in
+// http://[::1]:8545.
+func ValidateNodeURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid node URL: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("invalid node URL: scheme must be http or https, got %q", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return fmt.Errorf("invalid node URL: missing host")
+	}
+	if !strings.HasPrefix(parsed.Host, "[") && strings.Contains(parsed.Hostname(), ":") {
+		return fmt.Errorf("invalid node URL: IPv6 hosts must be bracketed, e.g. http://[::1]:8545")
+	}
+	return nil
+}
+
+// ListNodes returns every configured node in configuration order.
+func (m *ClientManager) ListNodes() []NodeInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	infos := make([]NodeInfo, 0, len(m.Nodes))
+	for _, node := range m.Nodes {
+		info := NodeInfo{
+			Name:         node.Name,
+			Region:       node.Region,
+			Archive:      node.Archive,
+			Healthy:      node.Healthy,
+			Draining:     node.Draining,
+			ErrorCount:   node.ErrorCount,
+			Functional:   node.FunctionalHealthy,
+			AvgLatencyMs: float64(node.AvgLatency) / float64(time.Millisecond),
+		}
+		if parsed, err := url.Parse(node.URL); err == nil {
+			info.Host = parsed.Host
+		}
+		if len(node.responseHeaders) > 0 {
+			info.Headers = make(map[string]string, len(node.responseHeaders))
+			for name, value := range node.responseHeaders {
+				info.Headers[name] = value
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// updateNodeGauges refreshes NodesConfigured and NodesHealthy after a node's health or the node
+// set changed. Callers must hold m.mu.
+func (m *ClientManager) updateNodeGauges() {
+	healthy := 0
+	for _, node := range m.Nodes {
+		if node.Healthy && !node.Draining {
+			healthy++
+		}
+	}
+	NodesConfigured.Set(float64(len(m.Nodes)))
+	NodesHealthy.Set(float64(healthy))
+}
+
+// captureResponseHeaders records the latest values of the CAPTURE_RESPONSE_HEADERS headers
+// (comma-separated, rate-limit headers by default) returned by node, and feeds the
+// RATE_LIMIT_REMAINING_HEADER value (X-RateLimit-Remaining by default) into NodeRateLimitRemaining.
+func (m *ClientManager) captureResponseHeaders(node *EthereumNode, header http.Header) {
+	names := os.Getenv("CAPTURE_RESPONSE_HEADERS")
+	if names == "" {
+		names = defaultCapturedHeaders
+	}
+
+	captured := make(map[string]string)
+	for _, name := range strings.Split(names, ",") {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if value := header.Get(name); name != "" && value != "" {
+			captured[name] = value
+		}
+	}
+	if len(captured) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	if node.responseHeaders == nil {
+		node.responseHeaders = make(map[string]string)
+	}
+	for name, value := range captured {
+		node.responseHeaders[name] = value
+	}
+	m.mu.Unlock()
+
+	remainingHeader := os.Getenv("RATE_LIMIT_REMAINING_HEADER")
+	if remainingHeader == "" {
+		remainingHeader = "X-RateLimit-Remaining"
+	}
+	if remaining, err := strconv.ParseFloat(captured[http.CanonicalHeaderKey(remainingHeader)], 64); err == nil {
+		NodeRateLimitRemaining.WithLabelValues(node.Name).Set(remaining)
+	}
+}
@@ -0,0 +1,15 @@
+package nodemanager
+
+import "context"
+
+// GetTransactionCount returns the nonce of address as of block, as a 0x-prefixed hex quantity.
+// Results are cached like other block-scoped reads (see blockCacheTTL), so pending nonces, which
+// change with every transaction sent, are never cached.
+func (m *ClientManager) GetTransactionCount(ctx context.Context, address string, block string) (string, error) {
+	if err := validateBlock(block); err != nil {
+		return "", err
+	}
+
+	ctx = forBlock(ctx, block)
+	return m.cachedCall(ctx, "eth_getTransactionCount", []interface{}{address, block}, m.blockCacheTTL(ctx, block), parseQuantity)
+}
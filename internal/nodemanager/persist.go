@@ -0,0 +1,99 @@
+package nodemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/luishsr/eth-proxy/utils"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SaveCache writes the cache to path as JSON. The file is written to a temporary file in the
+// same directory and renamed into place, so a crash never leaves a partial cache behind.
+func (m *ClientManager) SaveCache(path string) error {
+	m.mu.Lock()
+	data, err := json.Marshal(m.Cache)
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode cache: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed.
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace cache file: %w", err)
+	}
+
+	return nil
+}
+
+// LoadCache restores a cache saved by SaveCache, discarding entries that have already expired.
+// Files larger than CACHE_PERSIST_MAX_BYTES (64 MiB by default) are skipped so a runaway file
+// cannot stall startup. A missing file is not an error.
+func (m *ClientManager) LoadCache(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open cache file: %w", err)
+	}
+	defer file.Close()
+
+	maxBytes := int64(utils.GetEnvInt("CACHE_PERSIST_MAX_BYTES", 64<<20))
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		return fmt.Errorf("failed to read cache file: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return fmt.Errorf("cache file exceeds %d bytes, skipping", maxBytes)
+	}
+
+	var items map[string]CacheItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return fmt.Errorf("failed to decode cache file: %w", err)
+	}
+
+	restored := 0
+	m.mu.Lock()
+	for _, item := range items {
+		if time.Since(item.Timestamp) > cacheItemTTL(item) {
+			continue
+		}
+		// Re-key from the canonical form in case CACHE_HASH_KEYS changed since the file was saved.
+		m.Cache[cacheMapKey(item.Key)] = item
+		restored++
+	}
+	m.mu.Unlock()
+
+	utils.Logger.WithField("entries", restored).Info("Restored cache from disk")
+	return nil
+}
+
+// cacheItemTTL returns how long item stays fresh: the TTL it was stored with or, for items saved
+// before TTLs were recorded, the balance TTL (honoring per-address TTLs) or CACHE_EXPIRATION_SECONDS.
+func cacheItemTTL(item CacheItem) time.Duration {
+	if item.TTL > 0 {
+		return item.TTL
+	}
+	if address, block, ok := balanceParams(item); ok {
+		if isHistoricalBlock(block) {
+			return historicalCacheTTL()
+		}
+		return balanceCacheTTL(address)
+	}
+	return time.Duration(utils.GetEnvInt("CACHE_EXPIRATION_SECONDS", 60)) * time.Second
+}
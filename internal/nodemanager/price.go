@@ -0,0 +1,74 @@
+package nodemanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/luishsr/eth-proxy/utils"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// latestRoundDataSelector is the 4-byte selector of Chainlink's latestRoundData().
+const latestRoundDataSelector = "0xfeaf968c"
+
+// ErrPriceFeedNotConfigured is returned when no PRICE_FEED_ADDRESS is set.
+var ErrPriceFeedNotConfigured = errors.New("price feed not configured")
+
+// GetEthUsdPrice returns the ETH/USD price read from the Chainlink aggregator at PRICE_FEED_ADDRESS
+// (scaled by PRICE_FEED_DECIMALS, 8 by default). The price is shared across requests and cached
+// for PRICE_CACHE_SECONDS, with at most one refresh upstream per cache window.
+func (m *ClientManager) GetEthUsdPrice(ctx context.Context) (*big.Rat, error) {
+	feed := os.Getenv("PRICE_FEED_ADDRESS")
+	if feed == "" {
+		return nil, ErrPriceFeedNotConfigured
+	}
+
+	ttl := time.Duration(utils.GetEnvInt("PRICE_CACHE_SECONDS", 30)) * time.Second
+
+	price, err := m.priceCache.get(ctx, ttl, func(ctx context.Context) (interface{}, error) {
+		call := map[string]string{"to": feed, "data": latestRoundDataSelector}
+		result, err := m.Call(ctx, "eth_call", []interface{}{call, "latest"})
+		if err != nil {
+			return nil, err
+		}
+		return decodeLatestRoundAnswer(result, utils.GetEnvInt("PRICE_FEED_DECIMALS", 8))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return price.(*big.Rat), nil
+}
+
+// decodeLatestRoundAnswer extracts the answer (the second 32-byte word, an int256) from an ABI
+// encoded latestRoundData() result and scales it down by the feed's decimals.
+func decodeLatestRoundAnswer(result json.RawMessage, decimals int) (*big.Rat, error) {
+	var data string
+	if err := json.Unmarshal(result, &data); err != nil {
+		return nil, fmt.Errorf("invalid price feed result: %w", err)
+	}
+
+	data = strings.TrimPrefix(data, "0x")
+	if len(data) < 2*64 {
+		return nil, fmt.Errorf("invalid price feed result: expected at least 2 words, got %d hex digits", len(data))
+	}
+
+	answer, ok := new(big.Int).SetString(data[64:128], 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid price feed result: non-hex answer")
+	}
+	// Interpret as two's complement int256.
+	if answer.Bit(255) == 1 {
+		answer.Sub(answer, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+	if answer.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid price feed result: non-positive answer %s", answer)
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return new(big.Rat).SetFrac(answer, scale), nil
+}
@@ -0,0 +1,16 @@
+package nodemanager
+
+import "context"
+
+type clientRegionKey struct{}
+
+// WithClientRegion returns a copy of ctx whose calls prefer nodes in region.
+func WithClientRegion(ctx context.Context, region string) context.Context {
+	return context.WithValue(ctx, clientRegionKey{}, region)
+}
+
+// clientRegion returns the region calls made with ctx prefer, or "" for no preference.
+func clientRegion(ctx context.Context) string {
+	region, _ := ctx.Value(clientRegionKey{}).(string)
+	return region
+}
@@ -0,0 +1,49 @@
+package nodemanager
+
+import (
+	"encoding/json"
+	"github.com/luishsr/eth-proxy/utils"
+	"github.com/sirupsen/logrus"
+	"math/rand"
+	"regexp"
+	"strconv"
+)
+
+// addressPattern matches standalone 20-byte hex addresses, but not longer hex strings such as ABI words.
+var addressPattern = regexp.MustCompile(`\b0x[0-9a-fA-F]{40}\b`)
+
+// sampleUpstreamLog reports whether an upstream call should have its payloads logged, with
+// probability UPSTREAM_LOG_SAMPLE_RATE (0.0-1.0, 0 by default).
+func sampleUpstreamLog() bool {
+	raw := utils.GetEnv("UPSTREAM_LOG_SAMPLE_RATE")
+	if raw == "" {
+		return false
+	}
+	rate, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		utils.Logger.WithField("value", raw).Warn("Ignoring invalid UPSTREAM_LOG_SAMPLE_RATE")
+		return false
+	}
+	if rate <= 0 {
+		return false
+	}
+	return rand.Float64() < rate
+}
+
+// logSampledCall logs the full request and response payloads of an upstream call at debug level.
+// Addresses are redacted unless UPSTREAM_LOG_REDACT_ADDRESSES=false.
+func logSampledCall(node *EthereumNode, payload jsonRPCPayload, body []byte) {
+	request, _ := json.Marshal(payload)
+	requestText, responseText := string(request), string(body)
+	if utils.GetEnvBool("UPSTREAM_LOG_REDACT_ADDRESSES", true) {
+		requestText = addressPattern.ReplaceAllString(requestText, "0x[redacted]")
+		responseText = addressPattern.ReplaceAllString(responseText, "0x[redacted]")
+	}
+
+	utils.Logger.WithFields(logrus.Fields{
+		"node":     node.Name,
+		"method":   payload.Method,
+		"request":  requestText,
+		"response": responseText,
+	}).Debug("Sampled upstream call")
+}
@@ -0,0 +1,45 @@
+package nodemanager
+
+import (
+	"context"
+	"fmt"
+)
+
+// SelfTestResult is the outcome of the startup self-test for one node.
+type SelfTestResult struct {
+	Node    string `json:"node"`
+	Passed  bool   `json:"passed"`
+	Balance string `json:"balance,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SelfTest probes every node and fetches the balance of FUNCTIONAL_HEALTHCHECK_ADDRESS from each
+// one that is up, catching bad URLs, missing auth or gated methods before the first user request.
+// Results are in configuration order.
+func (m *ClientManager) SelfTest(ctx context.Context) []SelfTestResult {
+	statuses := m.CheckAllNodes(ctx)
+
+	m.mu.Lock()
+	nodes := make([]*EthereumNode, len(m.Nodes))
+	copy(nodes, m.Nodes)
+	m.mu.Unlock()
+
+	results := make([]SelfTestResult, len(statuses))
+	for i, status := range statuses {
+		results[i] = SelfTestResult{Node: status.Name}
+		if !status.Healthy {
+			results[i].Error = fmt.Sprintf("health check failed: %s", status.Error)
+			continue
+		}
+
+		balance, _, err := m.fetchBalanceFromNode(ctx, nodes[i], functionalCheckAddress(), "latest")
+		if err != nil {
+			results[i].Error = fmt.Sprintf("balance fetch failed: %v", err)
+			continue
+		}
+		results[i].Passed = true
+		results[i].Balance = balance
+	}
+
+	return results
+}
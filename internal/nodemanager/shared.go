@@ -0,0 +1,98 @@
+package nodemanager
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sharedValue caches a single network-wide value (e.g. the ETH/USD price) that every request
+// reads. Concurrent misses share one refresh, and once the value expires it keeps being served
+// for up to another TTL while a single background refresh replaces it (stale-while-revalidate).
+type sharedValue struct {
+	mu         sync.Mutex
+	value      interface{}
+	fetched    time.Time
+	refreshing chan struct{} // Non-nil while a refresh is in flight; closed when it completes.
+	err        error         // Outcome of the most recent refresh.
+}
+
+// get returns the cached value, refreshing it with fetch when it is missing or older than ttl.
+func (s *sharedValue) get(ctx context.Context, ttl time.Duration, fetch func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	s.mu.Lock()
+
+	if s.value != nil {
+		age := time.Since(s.fetched)
+		if age <= ttl {
+			value := s.value
+			s.mu.Unlock()
+			return value, nil
+		}
+		if age <= 2*ttl {
+			// Serve the stale value while one caller refreshes it in the background.
+			if s.refreshing == nil {
+				s.startRefresh(context.Background(), fetch)
+			}
+			value := s.value
+			s.mu.Unlock()
+			return value, nil
+		}
+	}
+
+	// Nothing usable is cached: join the in-flight refresh, or lead a new one. The refresh is
+	// detached from the leader's cancellation, so callers still waiting on it are not failed with
+	// an error that only concerned the leader.
+	done := s.refreshing
+	if done == nil {
+		done = s.startRefresh(detachedContext{ctx}, fetch)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.value, nil
+}
+
+// startRefresh runs fetch in the background and returns a channel closed once it completes.
+// The caller must hold s.mu.
+func (s *sharedValue) startRefresh(ctx context.Context, fetch func(ctx context.Context) (interface{}, error)) chan struct{} {
+	done := make(chan struct{})
+	s.refreshing = done
+
+	go func() {
+		value, err := fetch(ctx)
+
+		s.mu.Lock()
+		s.err = err
+		if err == nil {
+			s.value = value
+			s.fetched = time.Now()
+		}
+		s.refreshing = nil
+		s.mu.Unlock()
+		close(done)
+	}()
+
+	return done
+}
+
+// detachedContext carries a context's values (e.g. the per-node timeout) without its cancellation
+// or deadline.
+type detachedContext struct{ parent context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -0,0 +1,38 @@
+package nodemanager
+
+import (
+	"github.com/luishsr/eth-proxy/utils"
+	"time"
+)
+
+// recordUpstreamSuccess notes a successful upstream balance fetch, clearing UpstreamStale.
+func (m *ClientManager) recordUpstreamSuccess() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastUpstreamSuccess = time.Now()
+	if m.upstreamStale {
+		m.upstreamStale = false
+		UpstreamStale.Set(0)
+		utils.Logger.Info("Upstream balance fetches are succeeding again")
+	}
+}
+
+// checkUpstreamStale is called when a balance is served from cache. If no upstream balance fetch
+// has succeeded in the last UPSTREAM_STALE_SECONDS (300 by default), the proxy only looks healthy
+// thanks to the cache, so UpstreamStale is raised and a warning logged.
+func (m *ClientManager) checkUpstreamStale() {
+	threshold := time.Duration(utils.GetEnvInt("UPSTREAM_STALE_SECONDS", 300)) * time.Second
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	since := time.Since(m.lastUpstreamSuccess)
+	if since <= threshold || m.upstreamStale {
+		return
+	}
+
+	m.upstreamStale = true
+	UpstreamStale.Set(1)
+	utils.Logger.WithField("last_success_seconds", int(since.Seconds())).Warn("Serving balances from cache only; no upstream fetch has succeeded recently")
+}
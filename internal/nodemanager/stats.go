@@ -0,0 +1,70 @@
+package nodemanager
+
+import "time"
+
+// NodeSelectionShare compares how often a node was selected in the recent window with its fair share.
+// Nodes that are unhealthy, draining or in maintenance are not eligible for selection and have no expected share.
+type NodeSelectionShare struct {
+	Node          string  `json:"node"`
+	Eligible      bool    `json:"eligible"`
+	Selections    int     `json:"selections"`
+	ActualShare   float64 `json:"actualShare"`
+	ExpectedShare float64 `json:"expectedShare"`
+}
+
+// recordSelection appends a node selection to the sliding window and counts it towards the
+// current fairness round. Callers must hold m.mu.
+func (m *ClientManager) recordSelection(name string) {
+	if m.roundCounts != nil {
+		m.roundCounts[name]++
+	}
+
+	if len(m.selections) == 0 {
+		return
+	}
+
+	m.selections[m.selectionPos] = name
+	m.selectionPos = (m.selectionPos + 1) % len(m.selections)
+	if m.selectionCount < len(m.selections) {
+		m.selectionCount++
+	}
+}
+
+// SelectionStats reports each node's share of the last SELECTION_WINDOW selections against an
+// even round-robin share of the currently eligible nodes, making a node that hogs or starves
+// traffic easy to spot.
+func (m *ClientManager) SelectionStats() []NodeSelectionShare {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[string]int)
+	for i := 0; i < m.selectionCount; i++ {
+		counts[m.selections[i]]++
+	}
+
+	now := time.Now()
+	eligible := 0
+	for _, node := range m.Nodes {
+		if node.selectable(now) {
+			eligible++
+		}
+	}
+
+	shares := make([]NodeSelectionShare, 0, len(m.Nodes))
+	for _, node := range m.Nodes {
+		share := NodeSelectionShare{
+			Node:       node.Name,
+			Eligible:   node.selectable(now),
+			Selections: counts[node.Name],
+		}
+		if share.Eligible {
+			share.ExpectedShare = 1 / float64(eligible)
+		}
+		if m.selectionCount > 0 {
+			share.ActualShare = float64(share.Selections) / float64(m.selectionCount)
+		}
+		shares = append(shares, share)
+	}
+
+	return shares
+}
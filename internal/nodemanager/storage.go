@@ -0,0 +1,44 @@
+package nodemanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidSlot is returned for a storage slot that is not a 0x-prefixed hex quantity of at most 32 bytes.
+var ErrInvalidSlot = errors.New("invalid slot: expected a 0x-prefixed hex value of at most 32 bytes")
+
+// ErrInvalidData is returned when a node's result is not 0x-prefixed hex data.
+var ErrInvalidData = errors.New("non-hex data result from node")
+
+var (
+	slotPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{1,64}$`)
+	dataPattern = regexp.MustCompile(`^0x([0-9a-fA-F]{2})*$`)
+)
+
+// GetStorageAt returns the 32-byte value stored at slot of the contract at address, read at block.
+// Results are cached like other block-scoped reads (see blockCacheTTL).
+func (m *ClientManager) GetStorageAt(ctx context.Context, address string, slot string, block string) (string, error) {
+	if !slotPattern.MatchString(slot) {
+		return "", ErrInvalidSlot
+	}
+	if err := validateBlock(block); err != nil {
+		return "", err
+	}
+
+	ctx = forBlock(ctx, block)
+	return m.cachedCall(ctx, "eth_getStorageAt", []interface{}{address, strings.ToLower(slot), block}, m.blockCacheTTL(ctx, block), parseData)
+}
+
+// parseData decodes a JSON-RPC DATA result, lower-casing its hex digits.
+func parseData(raw json.RawMessage) (string, error) {
+	var data string
+	if err := json.Unmarshal(raw, &data); err != nil || !dataPattern.MatchString(data) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidData, truncate(string(raw), maxLoggedBodyBytes))
+	}
+	return strings.ToLower(data), nil
+}
@@ -0,0 +1,51 @@
+package nodemanager
+
+import (
+	"time"
+
+	"github.com/luishsr/eth-proxy/utils"
+)
+
+// Load-balancing strategies selectable with LB_STRATEGY.
+const (
+	StrategyRoundRobin = "round_robin" // Rotate through the nodes in order (the default).
+	StrategyLatency    = "latency"     // Prefer the node with the lowest average latency.
+)
+
+// latencyTolerance is how much slower than the fastest node a node may be and still count as
+// tied with it; tied nodes take turns.
+const latencyTolerance = 0.1
+
+// lbStrategy returns the configured LB_STRATEGY. Unknown values fall back to round-robin.
+func lbStrategy() string {
+	if utils.GetEnv("LB_STRATEGY") == StrategyLatency {
+		return StrategyLatency
+	}
+	return StrategyRoundRobin
+}
+
+// fastestNode returns the eligible node with the lowest AvgLatency and its index, scanning from
+// m.index so nodes within latencyTolerance of the fastest take turns rather than one staying hot;
+// nil if no node is eligible. Nodes without latency samples yet count as fastest, so every node
+// gets measured; as only successful fetches are measured, a failing node can look fastest, so
+// retries rely on nextNode excluding the nodes already tried. Callers must hold m.mu.
+func (m *ClientManager) fastestNode(eligible func(*EthereumNode) bool) (int, *EthereumNode) {
+	fastest := time.Duration(-1)
+	for _, node := range m.Nodes {
+		if eligible(node) && (fastest < 0 || node.AvgLatency < fastest) {
+			fastest = node.AvgLatency
+		}
+	}
+	if fastest < 0 {
+		return 0, nil
+	}
+
+	limit := time.Duration(float64(fastest) * (1 + latencyTolerance))
+	for offset := 0; offset < len(m.Nodes); offset++ {
+		i := (m.index + offset) % len(m.Nodes)
+		if node := m.Nodes[i]; eligible(node) && node.AvgLatency <= limit {
+			return i, node
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,55 @@
+package nodemanager
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// ErrNodeStuck marks a node whose block height stopped advancing while a peer's did.
+var ErrNodeStuck = errors.New("node is stuck: block height not advancing while peers advance")
+
+// nodeBlockHeight asks the node for its latest block number.
+func (m *ClientManager) nodeBlockHeight(ctx context.Context, node *EthereumNode) (uint64, error) {
+	result, _, err := m.callNode(ctx, node, "eth_blockNumber", []interface{}{})
+	if err != nil {
+		return 0, err
+	}
+	quantity, err := parseQuantity(result)
+	if err != nil {
+		return 0, err
+	}
+	height, err := strconv.ParseUint(quantity[2:], 16, 64)
+	if err != nil {
+		return 0, ErrInvalidQuantity
+	}
+	return height, nil
+}
+
+// recordBlockHeight notes the node's latest block height and reports whether the node is stuck:
+// its height has not changed in stuckChecks consecutive checks while a healthy peer is ahead of it.
+// A stuck node stays stuck until its height moves. Callers must hold m.mu.
+func (m *ClientManager) recordBlockHeight(node *EthereumNode, height uint64, stuckChecks int) bool {
+	if height != node.blockHeight {
+		node.blockHeight = height
+		node.stalledChecks = 0
+		node.stuck = false
+		return false
+	}
+	if node.stuck {
+		return true
+	}
+
+	node.stalledChecks++
+	if node.stalledChecks < stuckChecks {
+		return false
+	}
+	// Unhealthy or draining peers may report heights from before they failed, so only live peers count.
+	for _, peer := range m.Nodes {
+		if peer != node && peer.Healthy && !peer.Draining && peer.blockHeight > height {
+			node.stuck = true
+			return true
+		}
+	}
+	return false
+}
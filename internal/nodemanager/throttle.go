@@ -0,0 +1,81 @@
+package nodemanager
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// tokenBucket is a client-side request rate limit for a node, guarded by ClientManager.mu. A nil
+// bucket never limits.
+type tokenBucket struct {
+	rate   float64 // Tokens added per second.
+	burst  float64 // Most tokens the bucket holds.
+	tokens float64 // Tokens available; negative while requests wait for reserved tokens.
+	last   time.Time
+}
+
+// newTokenBucket returns a bucket allowing rps requests per second with bursts of up to rps
+// (at least 1), or nil for an unlimited node when rps is not positive.
+func newTokenBucket(rps float64) *tokenBucket {
+	if rps <= 0 {
+		return nil
+	}
+	burst := math.Max(1, math.Ceil(rps))
+	return &tokenBucket{rate: rps, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// refill adds the tokens accrued since the last refill.
+func (b *tokenBucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// available reports whether a request could start at now without waiting.
+func (b *tokenBucket) available(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.refill(now)
+	return b.tokens >= 1
+}
+
+// reserve takes a token, returning how long the caller must wait before using it.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// throttle waits until node's client-side rate limit lets a request through, recording the wait
+// in NodeThrottleWait. It returns ctx's error if the caller gives up first.
+func (m *ClientManager) throttle(ctx context.Context, node *EthereumNode) error {
+	if node.limiter == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	wait := node.limiter.reserve(time.Now())
+	m.mu.Unlock()
+
+	NodeThrottleWait.WithLabelValues(node.Name).Observe(wait.Seconds())
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
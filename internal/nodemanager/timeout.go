@@ -0,0 +1,23 @@
+package nodemanager
+
+import (
+	"context"
+	"github.com/luishsr/eth-proxy/utils"
+	"time"
+)
+
+type nodeTimeoutKey struct{}
+
+// WithNodeTimeout returns a copy of ctx whose upstream attempts time out after d, overriding
+// NODE_REQUEST_TIMEOUT_SECONDS for calls made with it.
+func WithNodeTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, nodeTimeoutKey{}, d)
+}
+
+// nodeTimeout returns the per-attempt timeout for calls made with ctx.
+func nodeTimeout(ctx context.Context) time.Duration {
+	if d, ok := ctx.Value(nodeTimeoutKey{}).(time.Duration); ok && d > 0 {
+		return d
+	}
+	return time.Duration(utils.GetEnvInt("NODE_REQUEST_TIMEOUT_SECONDS", 5)) * time.Second
+}
@@ -0,0 +1,92 @@
+package nodemanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidTimestamp is returned for a timestamp before the genesis block or in the future.
+var ErrInvalidTimestamp = errors.New("invalid timestamp: must be between the genesis block and now")
+
+// BlockAtTimestamp returns the number of the last block mined at or before timestamp (Unix
+// seconds), found by binary search over block timestamps. Once a later block exists the answer can
+// no longer change, so it is cached permanently.
+func (m *ClientManager) BlockAtTimestamp(ctx context.Context, timestamp int64) (string, error) {
+	if timestamp > time.Now().Unix() {
+		return "", ErrInvalidTimestamp
+	}
+	params := []interface{}{timestamp}
+	if item, found := m.getCached("blockAtTimestamp", params); found {
+		return item.Balance, nil
+	}
+
+	latestHex, err := m.BlockNumber(ctx)
+	if err != nil {
+		return "", err
+	}
+	latest, err := strconv.ParseUint(latestHex[2:], 16, 64)
+	if err != nil {
+		return "", ErrInvalidQuantity
+	}
+	latestTime, err := m.blockTimestamp(ctx, latest)
+	if err != nil {
+		return "", err
+	}
+	if timestamp >= latestTime {
+		// The next block may still be mined at or before timestamp, so the answer is not cached.
+		return latestHex, nil
+	}
+	genesisTime, err := m.blockTimestamp(ctx, 0)
+	if err != nil {
+		return "", err
+	}
+	if timestamp < genesisTime {
+		return "", ErrInvalidTimestamp
+	}
+
+	// Invariant: block low was mined at or before timestamp, block high after it.
+	low, high := uint64(0), latest
+	for high-low > 1 {
+		mid := low + (high-low)/2
+		midTime, err := m.blockTimestamp(ctx, mid)
+		if err != nil {
+			return "", err
+		}
+		if midTime <= timestamp {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	block := "0x" + strconv.FormatUint(low, 16)
+	m.setCached("blockAtTimestamp", params, block, nil, time.Now(), time.Duration(math.MaxInt64), "")
+	return block, nil
+}
+
+// blockTimestamp returns the Unix timestamp of the block at number.
+func (m *ClientManager) blockTimestamp(ctx context.Context, number uint64) (int64, error) {
+	raw, err := m.GetBlockByNumber(ctx, "0x"+strconv.FormatUint(number, 16), false)
+	if err != nil {
+		return 0, err
+	}
+	var block struct {
+		Timestamp json.RawMessage `json:"timestamp"`
+	}
+	if err := json.Unmarshal(raw, &block); err != nil || block.Timestamp == nil {
+		return 0, ErrInvalidQuantity
+	}
+	quantity, err := parseQuantity(block.Timestamp)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseInt(quantity[2:], 16, 64)
+	if err != nil {
+		return 0, ErrInvalidQuantity
+	}
+	return value, nil
+}
@@ -0,0 +1,70 @@
+package nodemanager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lookup phases recorded by a Timing.
+const (
+	PhaseValidation = "validation" // Parsing and validating the client's request.
+	PhaseCache      = "cache"      // Looking the result up in the cache.
+	PhaseSelect     = "select"     // Picking a node, including waiting for its rate limit.
+	PhaseUpstream   = "upstream"   // Calling nodes, summed across retries.
+)
+
+// Timing accumulates how long a single request spent in each phase. A nil Timing records nothing.
+type Timing struct {
+	mu     sync.Mutex
+	phases map[string]time.Duration
+	order  []string
+}
+
+type timingKey struct{}
+
+// WithTiming returns a copy of ctx whose lookups record their phase durations in the returned Timing.
+func WithTiming(ctx context.Context) (context.Context, *Timing) {
+	timing := &Timing{phases: make(map[string]time.Duration)}
+	return context.WithValue(ctx, timingKey{}, timing), timing
+}
+
+// timingFrom returns the Timing lookups made with ctx record into, or nil.
+func timingFrom(ctx context.Context) *Timing {
+	timing, _ := ctx.Value(timingKey{}).(*Timing)
+	return timing
+}
+
+// Add adds d to the time spent in phase.
+func (t *Timing) Add(phase string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, found := t.phases[phase]; !found {
+		t.order = append(t.order, phase)
+	}
+	t.phases[phase] += d
+}
+
+// since adds the time elapsed since start to phase.
+func (t *Timing) since(phase string, start time.Time) {
+	t.Add(phase, time.Since(start))
+}
+
+// String formats the phases in the order they were first recorded, e.g.
+// "validation=0.021ms, cache=0.004ms, select=0.009ms, upstream=1.532ms".
+func (t *Timing) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	parts := make([]string, 0, len(t.order))
+	for _, phase := range t.order {
+		parts = append(parts, fmt.Sprintf("%s=%.3fms", phase, float64(t.phases[phase])/float64(time.Millisecond)))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,75 @@
+package nodemanager
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/luishsr/eth-proxy/utils"
+	"net/http"
+	"os"
+)
+
+// NodeTLSOptions are the TLS settings for a private node: a CA bundle for self-signed
+// certificates, a client certificate and key for mutual TLS and, as a last resort,
+// skipping certificate verification altogether.
+type NodeTLSOptions struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// NewNodeTLSConfig loads the files referenced by opts into a tls.Config.
+func NewNodeTLSConfig(opts NodeTLSOptions) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", opts.CAFile)
+		}
+		config.RootCAs = roots
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// nodeClient returns a copy of client whose transport uses config for TLS, keeping the rest of
+// the transport's settings.
+func nodeClient(client *http.Client, name string, config *tls.Config) *http.Client {
+	if config.InsecureSkipVerify {
+		utils.Logger.WithField("node", name).Warn("TLS certificate verification is disabled for this node; its traffic can be intercepted")
+	}
+
+	var transport *http.Transport
+	if base, ok := client.Transport.(*http.Transport); ok {
+		transport = base.Clone()
+	} else {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	transport.TLSClientConfig = config
+
+	nodeClient := *client
+	nodeClient.Transport = transport
+	return &nodeClient
+}
+
+// clientFor returns the HTTP client used to reach node.
+func (m *ClientManager) clientFor(node *EthereumNode) *http.Client {
+	if node.client != nil {
+		return node.client
+	}
+	return m.httpClient
+}
@@ -0,0 +1,47 @@
+package nodemanager
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestNodeTLSCustomCA verifies a node with a self-signed certificate is reachable once its CA is configured
+func TestNodeTLSCustomCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1234"}`))
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write CA bundle: %v", err)
+	}
+
+	setEnv(t, "MAX_RETRIES", "0")
+	defer unsetEnv(t, "MAX_RETRIES")
+	address := "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D"
+
+	untrusted := NewClientManager([]NodeConfig{{Name: "PrivateNode", URL: server.URL}}, &http.Client{})
+	if _, err := untrusted.GetBalance(address); err == nil {
+		t.Fatalf("Expected the self-signed certificate to be rejected without a custom CA")
+	}
+
+	tlsConfig, err := NewNodeTLSConfig(NodeTLSOptions{CAFile: caFile})
+	if err != nil {
+		t.Fatalf("Unexpected error loading the CA bundle: %v", err)
+	}
+	manager := NewClientManager([]NodeConfig{{Name: "PrivateNode", URL: server.URL, TLS: tlsConfig}}, &http.Client{})
+	balance, err := manager.GetBalance(address)
+	if err != nil || balance != "0x1234" {
+		t.Fatalf("Expected 0x1234 via the custom CA, got %q, %v", balance, err)
+	}
+
+	if _, err := NewNodeTLSConfig(NodeTLSOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Errorf("Expected an error for a missing CA bundle")
+	}
+}
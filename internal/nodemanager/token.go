@@ -0,0 +1,46 @@
+package nodemanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// balanceOfSelector is the 4-byte selector of ERC-20's balanceOf(address).
+const balanceOfSelector = "0x70a08231"
+
+// GetTokenBalance returns holder's balance of the ERC-20 token at address token, as of block, as
+// a 0x-prefixed hex quantity in the token's smallest unit. It is read with an eth_call to
+// balanceOf(holder) through the usual failover path and cached like other block-scoped reads
+// (see blockCacheTTL).
+func (m *ClientManager) GetTokenBalance(ctx context.Context, token string, holder string, block string) (string, error) {
+	if err := validateBlock(block); err != nil {
+		return "", err
+	}
+
+	// ABI-encode the holder as a single 32-byte word, left-padded with zeros.
+	data := balanceOfSelector + strings.Repeat("0", 24) + strings.ToLower(strings.TrimPrefix(holder, "0x"))
+	call := map[string]string{"to": strings.ToLower(token), "data": data}
+	ctx = forBlock(ctx, block)
+	return m.cachedCall(ctx, "eth_call", []interface{}{call, block}, m.blockCacheTTL(ctx, block), parseUint256)
+}
+
+// parseUint256 decodes an ABI-encoded uint256 result, the first 32-byte word of the returned
+// data, as a 0x-prefixed hex quantity without leading zeros.
+func parseUint256(raw json.RawMessage) (string, error) {
+	data, err := parseData(raw)
+	if err != nil {
+		return "", err
+	}
+
+	word := strings.TrimPrefix(data, "0x")
+	if len(word) < 64 {
+		return "", fmt.Errorf("%w: expected a 32-byte word, got %q", ErrInvalidData, data)
+	}
+	quantity := strings.TrimLeft(word[:64], "0")
+	if quantity == "" {
+		quantity = "0"
+	}
+	return "0x" + quantity, nil
+}
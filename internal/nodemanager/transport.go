@@ -0,0 +1,114 @@
+package nodemanager
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/luishsr/eth-proxy/utils"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// NewUpstreamTransport builds the HTTP transport used to reach Ethereum nodes. HTTP/2 is
+// negotiated via ALPN with capable providers unless UPSTREAM_HTTP2=false, which pins
+// connections to HTTP/1.1 for providers with a flaky HTTP/2 implementation.
+//
+// For split-horizon DNS setups, UPSTREAM_HOST_OVERRIDES pins hostnames to fixed addresses
+// (e.g. "rpc.example.com=10.0.0.5,other.example.com:8545=10.0.0.6:8545") and
+// UPSTREAM_DNS_SERVER resolves the remaining hostnames through a specific DNS server, on
+// port 53 unless one is given. Invalid overrides are reported as an error.
+func NewUpstreamTransport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = utils.GetEnvInt("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", 10)
+
+	if utils.GetEnvBool("UPSTREAM_HTTP2", true) {
+		transport.ForceAttemptHTTP2 = true
+	} else {
+		// A non-nil, empty TLSNextProto map disables the transport's built-in HTTP/2 support.
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if server := os.Getenv("UPSTREAM_DNS_SERVER"); server != "" {
+		server = dnsServerAddress(server)
+		dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	overrides, err := ParseHostOverrides(os.Getenv("UPSTREAM_HOST_OVERRIDES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid UPSTREAM_HOST_OVERRIDES: %w", err)
+	}
+	transport.DialContext = overrideDialContext(dialer.DialContext, overrides)
+
+	return transport, nil
+}
+
+// dnsServerAddress appends the standard DNS port to a server given without one.
+func dnsServerAddress(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), "53")
+}
+
+// ParseHostOverrides parses a comma-separated list of host=address pairs. Either side may
+// include a port; an override without a port keeps the port being dialled.
+func ParseHostOverrides(raw string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid host override %q, expected host=address", entry)
+		}
+		overrides[strings.ToLower(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+	}
+
+	return overrides, nil
+}
+
+// overrideDialContext wraps dial so connections to overridden hosts go to the configured address.
+// Only the TCP destination changes; TLS still verifies the original hostname.
+func overrideDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error), overrides map[string]string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if len(overrides) == 0 {
+		return dial
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return dial(ctx, network, addr)
+		}
+
+		target, found := overrides[strings.ToLower(addr)]
+		if !found {
+			target, found = overrides[strings.ToLower(host)]
+		}
+		if found {
+			if _, _, err := net.SplitHostPort(target); err != nil {
+				target = net.JoinHostPort(target, port)
+			}
+			utils.Logger.WithFields(logrus.Fields{
+				"host":   addr,
+				"target": target,
+			}).Debug("Dialling upstream via host override")
+			addr = target
+		}
+
+		return dial(ctx, network, addr)
+	}
+}
@@ -0,0 +1,108 @@
+package nodemanager
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestNewUpstreamTransportHTTP2 verifies HTTP/2 is negotiated by default and can be disabled
+func TestNewUpstreamTransportHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	defer unsetEnv(t, "UPSTREAM_HTTP2")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	for _, tc := range []struct {
+		http2         string
+		expectedMajor int
+	}{
+		{http2: "", expectedMajor: 2},
+		{http2: "false", expectedMajor: 1},
+	} {
+		setEnv(t, "UPSTREAM_HTTP2", tc.http2)
+
+		transport, err := NewUpstreamTransport()
+		if err != nil {
+			t.Fatalf("Unexpected error building the transport: %v", err)
+		}
+		if transport.ForceAttemptHTTP2 != (tc.expectedMajor == 2) {
+			t.Errorf("UPSTREAM_HTTP2=%q: unexpected ForceAttemptHTTP2=%v", tc.http2, transport.ForceAttemptHTTP2)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err != nil {
+			t.Fatalf("UPSTREAM_HTTP2=%q: request failed: %v", tc.http2, err)
+		}
+		_ = resp.Body.Close()
+
+		if resp.ProtoMajor != tc.expectedMajor {
+			t.Errorf("UPSTREAM_HTTP2=%q: expected HTTP/%d, got %s", tc.http2, tc.expectedMajor, resp.Proto)
+		}
+		transport.CloseIdleConnections()
+	}
+}
+
+// TestNewUpstreamTransportHostOverride verifies a host override routes the dial to the configured address
+func TestNewUpstreamTransportHostOverride(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+
+	setEnv(t, "UPSTREAM_HOST_OVERRIDES", "eth-node.internal:8545="+server.Listener.Addr().String())
+	defer unsetEnv(t, "UPSTREAM_HOST_OVERRIDES")
+
+	transport, err := NewUpstreamTransport()
+	if err != nil {
+		t.Fatalf("Unexpected error building the transport: %v", err)
+	}
+
+	resp, err := (&http.Client{Transport: transport}).Get("http://eth-node.internal:8545/")
+	if err != nil {
+		t.Fatalf("Expected the override to route the request, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	host, _ := io.ReadAll(resp.Body)
+	if string(host) != "eth-node.internal:8545" {
+		t.Fatalf("Expected the original Host header to be preserved, got %q", host)
+	}
+}
+
+// TestNewUpstreamTransportInvalidHostOverrides verifies malformed overrides are rejected rather than ignored
+func TestNewUpstreamTransportInvalidHostOverrides(t *testing.T) {
+	setEnv(t, "UPSTREAM_HOST_OVERRIDES", "eth-node.internal=10.0.0.5,missing-address")
+	defer unsetEnv(t, "UPSTREAM_HOST_OVERRIDES")
+
+	if _, err := NewUpstreamTransport(); err == nil {
+		t.Fatalf("Expected an error for invalid UPSTREAM_HOST_OVERRIDES")
+	}
+}
+
+// TestDNSServerAddress verifies a DNS server given without a port defaults to port 53
+func TestDNSServerAddress(t *testing.T) {
+	for server, expected := range map[string]string{
+		"10.0.0.2":      "10.0.0.2:53",
+		"10.0.0.2:5353": "10.0.0.2:5353",
+		"dns.internal":  "dns.internal:53",
+		"::1":           "[::1]:53",
+		"[::1]":         "[::1]:53",
+		"[::1]:5353":    "[::1]:5353",
+	} {
+		if actual := dnsServerAddress(server); actual != expected {
+			t.Errorf("dnsServerAddress(%q): expected %q, got %q", server, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package nodemanager
+
+import (
+	"context"
+	"github.com/luishsr/eth-proxy/utils"
+	"time"
+)
+
+// WarmConnections health-checks every node once so each has a pooled connection, TLS handshake
+// included, before traffic arrives. It gives up after timeout so slow nodes cannot hold up
+// startup, and returns how many nodes answered. Probe outcomes update node health as usual.
+func (m *ClientManager) WarmConnections(timeout time.Duration) int {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	warmed := 0
+	for _, status := range m.CheckAllNodes(ctx) {
+		if status.Error == "" {
+			warmed++
+		}
+	}
+	utils.Logger.WithField("warmed", warmed).Info("Ethereum Node connections warmed up")
+	return warmed
+}
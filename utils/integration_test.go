@@ -15,6 +15,15 @@ var iterations int
 // This variable is used to control the duration of the load test
 var duration int
 
+// baseURL is the address of the running proxy the load tests target.
+var baseURL string
+
+// concurrency caps the number of in-flight requests in TestFetchBalances.
+var concurrency int
+
+// delay is the pause between launching each request in TestFetchBalances.
+var delay time.Duration
+
 var addresses = []string{
 	"0x5E447e8ecAAaaF0a2fe87fd0B6CF3C02DfBC336f",
 	"0x94cdB19C6c3B22a6eEa7160636F2426E02Bc3b58",
@@ -34,14 +43,20 @@ func init() {
 	// and the string is a description of the flag.
 	flag.IntVar(&iterations, "iterations", 1, "Number of times to run the test")
 	flag.IntVar(&duration, "duration", 10, "Duration (in seconds) to run the response time test")
+	flag.StringVar(&baseURL, "base-url", "http://localhost:8088", "Base URL of the running proxy")
+	flag.IntVar(&concurrency, "concurrency", 1, "Maximum number of concurrent requests in the balance fetch test")
+	flag.DurationVar(&delay, "delay", 100*time.Millisecond, "Delay between launching each request in the balance fetch test")
 }
 
 func TestFetchBalances(t *testing.T) {
 	flag.Parse() // Parse the command-line flags
+	if concurrency < 1 {
+		t.Fatalf("-concurrency must be at least 1, got %d", concurrency)
+	}
 
 	for i := 0; i < iterations; i++ {
 		t.Logf("Iteration %d/%d", i+1, iterations)
-		throttle := make(chan struct{}, 1)
+		throttle := make(chan struct{}, concurrency)
 		var wg sync.WaitGroup
 
 		for _, address := range addresses {
@@ -51,7 +66,7 @@ func TestFetchBalances(t *testing.T) {
 				throttle <- struct{}{}
 				defer func() { <-throttle }()
 
-				url := fmt.Sprintf("http://localhost:8080/eth/balance/%s", addr)
+				url := fmt.Sprintf("%s/eth/balance/%s", baseURL, addr)
 				resp, err := http.Get(url)
 				if err != nil {
 					t.Errorf("Error fetching balance for address %s: %s", addr, err)
@@ -71,8 +86,8 @@ func TestFetchBalances(t *testing.T) {
 
 			}(address)
 
-			// Sleep N milliseconds between launching each goroutine
-			time.Sleep(100 * time.Millisecond)
+			// Sleep between launching each goroutine
+			time.Sleep(delay)
 		}
 
 		wg.Wait()
@@ -88,6 +103,8 @@ func TestAPIResponseTime(t *testing.T) {
 
 	endTime := time.Now().Add(time.Duration(duration) * time.Second)
 
+	// Response times are recorded from concurrent goroutines, so mu guards both totals.
+	var mu sync.Mutex
 	var totalResponseTime time.Duration
 	var requestCount int64
 
@@ -103,21 +120,30 @@ func TestAPIResponseTime(t *testing.T) {
 				defer wg.Done()
 
 				startTime := time.Now()
-				url := fmt.Sprintf("http://localhost:8080/eth/balance/%s", addr)
-				_, err := http.Get(url)
+				url := fmt.Sprintf("%s/eth/balance/%s", baseURL, addr)
+				resp, err := http.Get(url)
 				if err != nil {
 					t.Logf("Error fetching balance for address %s: %s", addr, err)
 					return
 				}
+				// Read the whole body so the response time covers the full response.
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
 
 				responseTime := time.Since(startTime)
+				mu.Lock()
 				totalResponseTime += responseTime
 				requestCount++
+				mu.Unlock()
 			}(address)
 		}
 		wg.Wait()
 
-		// Calculate and log the average response time after each batch of requests
+		// Calculate and log the average response time after each batch of requests; wg.Wait makes the
+		// batch's updates visible without taking mu.
+		if requestCount == 0 {
+			continue // Every request failed so far; there is no average to report
+		}
 		avgResponseTime := totalResponseTime.Seconds() * 1000 / float64(requestCount)  // Convert to milliseconds
 		fmt.Printf("\r\033[32mAverage response time: %.2f ms\033[0m", avgResponseTime) // Use \r to overwrite the line and ANSI codes for green color
 	}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// Profiles are named presets of environment defaults selected with PROFILE. A variable set
+// explicitly in the environment always takes precedence over the profile's value.
+var Profiles = map[string]map[string]string{
+	"low-latency": {
+		"CACHE_EXPIRATION_SECONDS":     "5",
+		"MAX_RETRIES":                  "1",
+		"NODE_REQUEST_TIMEOUT_SECONDS": "2",
+		"BATCH_CONCURRENCY":            "16",
+		"LB_STRATEGY":                  "latency",
+	},
+	"high-throughput": {
+		"CACHE_EXPIRATION_SECONDS":         "30",
+		"MAX_RETRIES":                      "2",
+		"NODE_REQUEST_TIMEOUT_SECONDS":     "5",
+		"BATCH_CONCURRENCY":                "32",
+		"UPSTREAM_MAX_IDLE_CONNS_PER_HOST": "100",
+	},
+	"cost-optimized": {
+		"CACHE_EXPIRATION_SECONDS":     "300",
+		"MAX_RETRIES":                  "1",
+		"NODE_REQUEST_TIMEOUT_SECONDS": "10",
+		"BATCH_CONCURRENCY":            "4",
+		"GAS_PRICE_CACHE_SECONDS":      "30",
+	},
+}
+
+// profileDefault returns the value the selected PROFILE sets for key, or "" if there is none.
+func profileDefault(key string) string {
+	return Profiles[strings.ToLower(strings.TrimSpace(os.Getenv("PROFILE")))][key]
+}
+
+// ValidateProfile logs the selected PROFILE at startup, warning if it is not a known profile.
+func ValidateProfile() {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("PROFILE")))
+	if name == "" {
+		return
+	}
+	if _, ok := Profiles[name]; !ok {
+		names := make([]string, 0, len(Profiles))
+		for known := range Profiles {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		Logger.WithField("profile", name).Warnf("Ignoring unknown PROFILE, expected one of %s", strings.Join(names, ", "))
+		return
+	}
+	Logger.WithField("profile", name).Info("Using configuration profile")
+}
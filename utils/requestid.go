@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+)
+
+// DefaultRequestIDHeader is the header used for request correlation when REQUEST_ID_HEADER is unset.
+const DefaultRequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestIDHeader returns the header name used to read, echo and forward request IDs.
+func RequestIDHeader() string {
+	if header := os.Getenv("REQUEST_ID_HEADER"); header != "" {
+		return header
+	}
+	return DefaultRequestIDHeader
+}
+
+// NewRequestID generates a random 128-bit request ID.
+func NewRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -1,17 +1,25 @@
 package utils
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/sirupsen/logrus"
+	"math/big"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
-	ErrInvalidAddress = errors.New("invalid Ethereum address")
-	Logger            = logrus.New()
+	ErrInvalidAddress   = errors.New("invalid Ethereum address")
+	ErrMissingAddress   = errors.New("missing address")
+	ErrMalformedAddress = errors.New("malformed address")
+	ErrInvalidChecksum  = errors.New("invalid checksum")
+	Logger              = logrus.New()
 )
 
 func init() {
@@ -36,8 +44,175 @@ func RespondError(w http.ResponseWriter, statusCode int, message string) {
 	RespondJSON(w, statusCode, map[string]string{"error": message})
 }
 
+// RespondErrorCode sends an error response carrying a machine-readable code alongside the message
+func RespondErrorCode(w http.ResponseWriter, statusCode int, code string, message string) {
+	RespondJSON(w, statusCode, map[string]string{"error": message, "code": code})
+}
+
+// shedError is the body of a load-shedding response.
+type shedError struct {
+	Code         string `json:"code"`
+	Message      string `json:"message"`
+	RetryAfterMs int64  `json:"retryAfterMs"`
+}
+
+// RespondShed sends a load-shedding response telling the client why it was turned away and, in
+// both the body and the Retry-After header (rounded up to whole seconds), when to retry.
+func RespondShed(w http.ResponseWriter, statusCode int, code string, message string, retryAfter time.Duration) {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	RespondJSON(w, statusCode, map[string]shedError{"error": {Code: code, Message: message, RetryAfterMs: retryAfter.Milliseconds()}})
+}
+
+// GetEnv reads an environment variable, trimming surrounding whitespace and a matching pair
+// of quotes that some .env loaders and shells leave in place (e.g. "5" or '5'). Unset variables
+// fall back to the selected PROFILE's default, if any (see Profiles).
+func GetEnv(key string) string {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return profileDefault(key)
+	}
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = strings.TrimSpace(value[1 : len(value)-1])
+	}
+	return value
+}
+
+// GetEnvInt reads a positive integer from the environment, falling back to defaultValue when
+// unset or invalid. Invalid values are logged so misconfiguration does not go unnoticed.
+func GetEnvInt(key string, defaultValue int) int {
+	raw := GetEnv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(raw)
+	if err == nil && value == 0 && defaultValue == 0 {
+		return 0 // An explicit 0 for a setting that is off by default.
+	}
+	if err != nil || value <= 0 {
+		Logger.WithFields(logrus.Fields{"key": key, "value": raw, "default": defaultValue}).Warn("Ignoring invalid integer environment variable, expected a positive integer")
+		return defaultValue
+	}
+	return value
+}
+
+// GetEnvBool reads a boolean from the environment, falling back to defaultValue when unset or
+// invalid. Invalid values are logged so misconfiguration does not go unnoticed.
+func GetEnvBool(key string, defaultValue bool) bool {
+	raw := GetEnv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		Logger.WithFields(logrus.Fields{"key": key, "value": raw, "default": defaultValue}).Warn("Ignoring invalid boolean environment variable")
+		return defaultValue
+	}
+	return value
+}
+
+// HexToDecimalString converts a 0x-prefixed hex quantity, such as a wei balance, to base 10
+// without losing precision.
+func HexToDecimalString(hex string) (string, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(hex, "0x"), "0X")
+	if digits == hex || digits == "" {
+		return "", fmt.Errorf("invalid hex quantity %q: expected 0x-prefixed hex digits", hex)
+	}
+	value, ok := new(big.Int).SetString(digits, 16)
+	if !ok {
+		return "", fmt.Errorf("invalid hex quantity %q: expected 0x-prefixed hex digits", hex)
+	}
+	return value.String(), nil
+}
+
+// ErrUnknownUnit is returned by WeiToUnit for a denomination other than wei, gwei or ether.
+var ErrUnknownUnit = errors.New("unknown unit: expected wei, gwei or ether")
+
+// unitDecimals is the number of decimal places of wei in each supported denomination.
+var unitDecimals = map[string]int64{"wei": 0, "gwei": 9, "ether": 18}
+
+// WeiToUnit converts a 0x-prefixed hex wei amount to unit ("wei", "gwei" or "ether") as an exact
+// fixed-point decimal string without trailing zeros, e.g. "0x1bc16d674ec80000" in ether is "2".
+func WeiToUnit(weiHex string, unit string) (string, error) {
+	decimals, ok := unitDecimals[unit]
+	if !ok {
+		return "", ErrUnknownUnit
+	}
+	decimal, err := HexToDecimalString(weiHex)
+	if err != nil {
+		return "", err
+	}
+
+	wei, _ := new(big.Int).SetString(decimal, 10)
+	value := new(big.Rat).SetFrac(wei, new(big.Int).Exp(big.NewInt(10), big.NewInt(decimals), nil))
+	formatted := value.FloatString(int(decimals))
+	if strings.Contains(formatted, ".") {
+		formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	}
+	return formatted, nil
+}
+
 // IsValidEthereumAddress checks if the provided string is a valid Ethereum address.
 func IsValidEthereumAddress(address string) bool {
-	// Ethereum addresses are 42 characters long and start with '0x'.
-	return len(address) == 42 && strings.HasPrefix(address, "0x")
+	// Ethereum addresses are 42 characters long: '0x' followed by 40 hex digits.
+	return len(address) == 42 && strings.HasPrefix(address, "0x") && isHex(address[2:])
+}
+
+// ValidateEthereumAddress reports why an address is unusable: ErrMissingAddress when it is empty,
+// ErrMalformedAddress when it is not 0x followed by 40 hex digits, and ErrInvalidChecksum when a
+// mixed-case address fails EIP-55 verification. All-lowercase and all-uppercase addresses carry
+// no checksum and are accepted.
+func ValidateEthereumAddress(address string) error {
+	if address == "" {
+		return ErrMissingAddress
+	}
+	if !IsValidEthereumAddress(address) {
+		return ErrMalformedAddress
+	}
+
+	hexPart := address[2:]
+	if hexPart == strings.ToLower(hexPart) || hexPart == strings.ToUpper(hexPart) {
+		return nil
+	}
+	if toChecksumAddress(hexPart) != address {
+		return ErrInvalidChecksum
+	}
+
+	return nil
+}
+
+// IsValidChecksumAddress reports whether address is exactly in its EIP-55 mixed-case checksum form.
+// Unlike ValidateEthereumAddress, all-lowercase and all-uppercase addresses are rejected unless
+// they contain no letters.
+func IsValidChecksumAddress(address string) bool {
+	return IsValidEthereumAddress(address) && toChecksumAddress(address[2:]) == address
+}
+
+// toChecksumAddress returns the EIP-55 mixed-case form of a 40-digit hex address.
+func toChecksumAddress(hexPart string) string {
+	lower := strings.ToLower(hexPart)
+	hash := hex.EncodeToString(Keccak256([]byte(lower)))
+
+	checksummed := []byte(lower)
+	for i, c := range checksummed {
+		// Letters are uppercased when the matching nibble of the hash is 8 or higher.
+		if c >= 'a' && c <= 'f' && hash[i] >= '8' {
+			checksummed[i] = c - 'a' + 'A'
+		}
+	}
+
+	return "0x" + string(checksummed)
+}
+
+// isHex reports whether s consists solely of hexadecimal digits.
+func isHex(s string) bool {
+	for _, c := range s {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+			return false
+		}
+	}
+	return true
 }
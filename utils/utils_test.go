@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"os"
+	"testing"
+)
+
+// TestIsValidEthereumAddress verifies the address shape check, including the hex digits
+func TestIsValidEthereumAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		valid   bool
+	}{
+		{"lowercase", "0x00a3ac5e156b4b291ceb59d019121beb6508d93d", true},
+		{"uppercase", "0x00A3AC5E156B4B291CEB59D019121BEB6508D93D", true},
+		{"mixed", "0x00a3Ac5E156B4B291ceB59D019121beB6508d93D", true},
+		{"too short", "0x00a3ac5e156b4b291ceb59d019121beb6508d93", false},
+		{"too long", "0x00a3ac5e156b4b291ceb59d019121beb6508d93d0", false},
+		{"missing prefix", "0000a3ac5e156b4b291ceb59d019121beb6508d93d", false},
+		{"non-hex", "0xGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGG", false},
+		{"one non-hex digit", "0x00a3ac5e156b4b291ceb59d019121beb6508d93z", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsValidEthereumAddress(tt.address); got != tt.valid {
+				t.Errorf("IsValidEthereumAddress(%q) = %v, want %v", tt.address, got, tt.valid)
+			}
+		})
+	}
+}
+
+// TestHexToDecimalString verifies hex quantities convert to base 10 without losing precision
+func TestHexToDecimalString(t *testing.T) {
+	tests := []struct {
+		hex     string
+		decimal string
+		valid   bool
+	}{
+		{"0x0", "0", true},
+		{"0x10", "16", true},
+		{"0x1bc16d674ec80000", "2000000000000000000", true},
+		{"0xffffffffffffffffffffffffffffffff", "340282366920938463463374607431768211455", true},
+		{"10", "", false},
+		{"0x", "", false},
+		{"0xzz", "", false},
+	}
+
+	for _, tt := range tests {
+		decimal, err := HexToDecimalString(tt.hex)
+		if tt.valid && (err != nil || decimal != tt.decimal) {
+			t.Errorf("HexToDecimalString(%q) = %q, %v, want %q", tt.hex, decimal, err, tt.decimal)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("HexToDecimalString(%q) = %q, want an error", tt.hex, decimal)
+		}
+	}
+}
+
+// TestWeiToUnit verifies exact conversions between wei, gwei and ether
+func TestWeiToUnit(t *testing.T) {
+	tests := []struct {
+		wei      string
+		unit     string
+		expected string
+	}{
+		{"0x1bc16d674ec80000", "ether", "2"},
+		{"0x1bc16d674ec80000", "gwei", "2000000000"},
+		{"0x1bc16d674ec80000", "wei", "2000000000000000000"},
+		{"0x1", "ether", "0.000000000000000001"},
+		{"0x3b9aca01", "gwei", "1.000000001"},
+		{"0xffffffffffffffffffffffffffffffff", "ether", "340282366920938463463.374607431768211455"},
+	}
+
+	for _, tt := range tests {
+		got, err := WeiToUnit(tt.wei, tt.unit)
+		if err != nil || got != tt.expected {
+			t.Errorf("WeiToUnit(%q, %q) = %q, %v, want %q", tt.wei, tt.unit, got, err, tt.expected)
+		}
+	}
+
+	if _, err := WeiToUnit("0x1", "finney"); err != ErrUnknownUnit {
+		t.Errorf("Expected ErrUnknownUnit for an unknown unit, got %v", err)
+	}
+}
+
+// TestGetEnvIntTrimsQuotesAndWhitespace verifies quoted and padded numeric values are parsed
+// and invalid ones fall back to the default
+func TestGetEnvIntTrimsQuotesAndWhitespace(t *testing.T) {
+	defer os.Unsetenv("TEST_ENV_INT")
+
+	tests := []struct {
+		value    string
+		expected int
+	}{
+		{`"5"`, 5},
+		{`'5'`, 5},
+		{"  5  ", 5},
+		{` " 5 " `, 5},
+		{`"5`, 10},
+		{"five", 10},
+		{"-1", 10},
+		{"", 10},
+	}
+
+	for _, tt := range tests {
+		os.Setenv("TEST_ENV_INT", tt.value)
+		if got := GetEnvInt("TEST_ENV_INT", 10); got != tt.expected {
+			t.Errorf("GetEnvInt with %q = %d, want %d", tt.value, got, tt.expected)
+		}
+	}
+}
+
+// TestGetEnvBoolTrimsQuotes verifies quoted boolean values are parsed
+func TestGetEnvBoolTrimsQuotes(t *testing.T) {
+	defer os.Unsetenv("TEST_ENV_BOOL")
+
+	os.Setenv("TEST_ENV_BOOL", ` "false" `)
+	if GetEnvBool("TEST_ENV_BOOL", true) {
+		t.Error("Expected a quoted false to be parsed")
+	}
+	os.Setenv("TEST_ENV_BOOL", "maybe")
+	if !GetEnvBool("TEST_ENV_BOOL", true) {
+		t.Error("Expected an invalid boolean to fall back to the default")
+	}
+}
+
+// TestGetEnvProfileDefaults verifies each profile supplies its defaults and explicit variables
+// override them
+func TestGetEnvProfileDefaults(t *testing.T) {
+	defer os.Unsetenv("PROFILE")
+	defer os.Unsetenv("CACHE_EXPIRATION_SECONDS")
+	os.Unsetenv("CACHE_EXPIRATION_SECONDS")
+	os.Unsetenv("MAX_RETRIES")
+	os.Unsetenv("NODE_REQUEST_TIMEOUT_SECONDS")
+	os.Unsetenv("BATCH_CONCURRENCY")
+
+	tests := []struct {
+		profile                                 string
+		cacheTTL, retries, timeout, concurrency int
+	}{
+		{"low-latency", 5, 1, 2, 16},
+		{"high-throughput", 30, 2, 5, 32},
+		{"cost-optimized", 300, 1, 10, 4},
+		{"unknown", 60, 3, 5, 8},
+		{"", 60, 3, 5, 8},
+	}
+
+	for _, tt := range tests {
+		os.Setenv("PROFILE", tt.profile)
+		if got := GetEnvInt("CACHE_EXPIRATION_SECONDS", 60); got != tt.cacheTTL {
+			t.Errorf("%q: CACHE_EXPIRATION_SECONDS = %d, want %d", tt.profile, got, tt.cacheTTL)
+		}
+		if got := GetEnvInt("MAX_RETRIES", 3); got != tt.retries {
+			t.Errorf("%q: MAX_RETRIES = %d, want %d", tt.profile, got, tt.retries)
+		}
+		if got := GetEnvInt("NODE_REQUEST_TIMEOUT_SECONDS", 5); got != tt.timeout {
+			t.Errorf("%q: NODE_REQUEST_TIMEOUT_SECONDS = %d, want %d", tt.profile, got, tt.timeout)
+		}
+		if got := GetEnvInt("BATCH_CONCURRENCY", 8); got != tt.concurrency {
+			t.Errorf("%q: BATCH_CONCURRENCY = %d, want %d", tt.profile, got, tt.concurrency)
+		}
+	}
+
+	os.Setenv("PROFILE", " Low-Latency ")
+	os.Setenv("CACHE_EXPIRATION_SECONDS", "120")
+	if got := GetEnvInt("CACHE_EXPIRATION_SECONDS", 60); got != 120 {
+		t.Errorf("Expected explicit CACHE_EXPIRATION_SECONDS to override the profile, got %d", got)
+	}
+	if got := GetEnv("LB_STRATEGY"); got != "latency" {
+		t.Errorf("Expected low-latency profile to select the latency strategy, got %q", got)
+	}
+}